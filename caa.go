@@ -0,0 +1,62 @@
+package dnsupdate
+
+import (
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// CAAIssue returns a CAA record authorizing a certificate authority,
+// identified by its domain name such as "letsencrypt.org", to issue
+// certificates for a name. Parameters, such as "accounturi=...", are
+// appended to the value.
+func CAAIssue(name, issuer string, params ...string) libdns.CAA {
+	return libdns.CAA{Name: name, Tag: "issue", Value: caaIssuerValue(issuer, params)}
+}
+
+// CAAIssueWild returns a CAA record authorizing a certificate authority to
+// issue wildcard certificates for a name.
+func CAAIssueWild(name, issuer string, params ...string) libdns.CAA {
+	return libdns.CAA{Name: name, Tag: "issuewild", Value: caaIssuerValue(issuer, params)}
+}
+
+// CAAIodef returns a CAA record asking certificate authorities to report
+// invalid certificate requests for a name to a URL, such as
+// "mailto:security@example.com".
+func CAAIodef(name, url string) libdns.CAA {
+	return libdns.CAA{Name: name, Tag: "iodef", Value: url}
+}
+
+func caaIssuerValue(issuer string, params []string) string {
+	return strings.Join(append([]string{issuer}, params...), "; ")
+}
+
+// marshalCAA converts a CAA record to a RR, without going through the
+// presentation format which libdns and miekg/dns quote differently. Note that
+// miekg/dns expects escaped values when packing them, but returns raw values
+// when unpacking them.
+func marshalCAA(fqdn string, record libdns.CAA) dns.RR {
+	return &dns.CAA{
+		Hdr: dns.RR_Header{
+			Name:   fqdn,
+			Rrtype: dns.TypeCAA,
+			Class:  dns.ClassINET,
+			Ttl:    uint32(record.TTL / time.Second),
+		},
+		Flag:  record.Flags,
+		Tag:   record.Tag,
+		Value: escapeString(record.Value),
+	}
+}
+
+func unmarshalCAA(rr *dns.CAA) libdns.CAA {
+	return libdns.CAA{
+		Name:  rr.Hdr.Name,
+		TTL:   time.Duration(rr.Hdr.Ttl) * time.Second,
+		Flags: rr.Flag,
+		Tag:   rr.Tag,
+		Value: rr.Value,
+	}
+}
@@ -0,0 +1,95 @@
+package dnsupdate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// cachedZone holds the records of a zone listed by GetRecords.
+type cachedZone struct {
+	serial  uint32
+	records []libdns.Record
+	checked time.Time
+}
+
+// cachedRecords returns the cached records of a zone, if they are recent
+// enough or if the SOA serial of the zone didn't change since.
+func (p *Provider) cachedRecords(ctx context.Context, zone string) ([]libdns.Record, bool) {
+	key := dns.CanonicalName(zone)
+	p.mu.Lock()
+	cached := p.cache[key]
+	p.mu.Unlock()
+	if cached == nil {
+		return nil, false
+	}
+
+	if time.Since(cached.checked) >= p.CacheTTL {
+		serial, err := p.querySerial(ctx, zone)
+		if err != nil || serial != cached.serial {
+			return nil, false
+		}
+
+		p.mu.Lock()
+		if p.cache[key] == cached {
+			p.cache[key] = &cachedZone{serial: serial, records: cached.records, checked: time.Now()}
+		}
+		p.mu.Unlock()
+	}
+	return slices.Clone(cached.records), true
+}
+
+// cacheRecords caches the records of a zone, transferred at the given SOA
+// serial.
+func (p *Provider) cacheRecords(zone string, serial uint32, records []libdns.Record) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cache == nil {
+		p.cache = make(map[string]*cachedZone)
+	}
+	p.cache[dns.CanonicalName(zone)] = &cachedZone{
+		serial:  serial,
+		records: slices.Clone(records),
+		checked: time.Now(),
+	}
+}
+
+// invalidateCache removes the cached records of a zone after a change.
+func (p *Provider) invalidateCache(zone string) {
+	p.mu.Lock()
+	delete(p.cache, dns.CanonicalName(zone))
+	p.mu.Unlock()
+}
+
+// zoneSerial returns the SOA serial of a zone from its records, if they
+// start with the SOA record, or else queries it.
+func (p *Provider) zoneSerial(ctx context.Context, zone string, rrs []dns.RR) (uint32, error) {
+	if len(rrs) > 0 {
+		if soa, ok := rrs[0].(*dns.SOA); ok {
+			return soa.Serial, nil
+		}
+	}
+	return p.querySerial(ctx, zone)
+}
+
+// querySerial queries the SOA serial of a zone.
+func (p *Provider) querySerial(ctx context.Context, zone string) (uint32, error) {
+	var query dns.Msg
+	query.SetQuestion(zone, dns.TypeSOA)
+	query.RecursionDesired = false
+
+	reply, err := p.roundTrip(ctx, &query)
+	if err != nil {
+		return 0, err
+	}
+	for _, rr := range reply.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, nil
+		}
+	}
+	return 0, fmt.Errorf("no SOA record found for %v", zone)
+}
@@ -0,0 +1,199 @@
+// Package caddy wraps the DNS UPDATE provider as a Caddy module, to solve
+// ACME DNS challenges with it.
+//
+// It is a separate Go module, so that the main package doesn't depend on
+// Caddy. Build Caddy with it using xcaddy:
+//
+//	xcaddy build --with github.com/libdns/dnsupdate/caddy
+package caddy
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/libdns/dnsupdate"
+	"github.com/libdns/dnsupdate/doq"
+)
+
+// Provider lets Caddy read and manipulate DNS records with DNS UPDATE. It
+// accepts the same JSON options as dnsupdate.Provider, and string options
+// can contain placeholders such as {env.TSIG_SECRET}.
+type Provider struct{ *dnsupdate.Provider }
+
+func init() {
+	caddy.RegisterModule(Provider{})
+}
+
+// CaddyModule returns the Caddy module information.
+func (Provider) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "dns.providers.dnsupdate",
+		New: func() caddy.Module { return &Provider{new(dnsupdate.Provider)} },
+	}
+}
+
+// Provision replaces the placeholders in string options, logs exchanges
+// with Caddy's logger, and enables DNS-over-QUIC.
+func (p *Provider) Provision(ctx caddy.Context) error {
+	p.Logger = ctx.Slogger()
+	p.QUICTransport = new(doq.Transport)
+
+	replacePlaceholders(caddy.NewReplacer(), reflect.ValueOf(p.Provider).Elem())
+	return nil
+}
+
+// replacePlaceholders replaces the placeholders in the strings of a value
+// set from JSON options, including in nested structs, slices and maps such
+// as zones and views.
+func replacePlaceholders(repl *caddy.Replacer, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(repl.ReplaceAll(v.String(), ""))
+	case reflect.Pointer:
+		if !v.IsNil() {
+			replacePlaceholders(repl, v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.IsExported() && field.Tag.Get("json") != "-" {
+				replacePlaceholders(repl, v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			replacePlaceholders(repl, v.Index(i))
+		}
+	case reflect.Map:
+		// Map entries aren't addressable, so they are replaced by copies
+		iter := v.MapRange()
+		var keys, values []reflect.Value
+		for iter.Next() {
+			key := reflect.New(iter.Key().Type()).Elem()
+			key.Set(iter.Key())
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			replacePlaceholders(repl, key)
+			replacePlaceholders(repl, value)
+			v.SetMapIndex(iter.Key(), reflect.Value{})
+			keys, values = append(keys, key), append(values, value)
+		}
+		for i := range keys {
+			v.SetMapIndex(keys[i], values[i])
+		}
+	}
+}
+
+// UnmarshalCaddyfile sets up the provider from Caddyfile tokens. Options are
+// named like in JSON:
+//
+//	dnsupdate [<addr>] {
+//	    addr <addr>
+//	    addrs <addr...>
+//	    tsig_key_name <name>
+//	    tsig_secret <secret>
+//	    ...
+//	}
+//
+// Boolean options may be given without a value to enable them. The
+// zones and views options, and the deprecated zone_keys, are only
+// available in JSON.
+func (p *Provider) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // consume the directive name
+
+	if d.NextArg() {
+		p.Addr = d.Val()
+	}
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+
+	for d.NextBlock(0) {
+		name := d.Val()
+		f, ok := optionField(p.Provider, name)
+		if !ok {
+			return d.Errf("unrecognized option %q", name)
+		}
+		if err := setOption(f, d.RemainingArgs()); err != nil {
+			return d.Errf("invalid %v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// optionField returns the field of a provider with the given JSON name.
+func optionField(p *dnsupdate.Provider, name string) (reflect.Value, bool) {
+	v := reflect.ValueOf(p).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		if tag == name && tag != "-" {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setOption sets a field from the arguments of a Caddyfile option.
+func setOption(f reflect.Value, args []string) error {
+	if f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.String {
+		f.Set(reflect.AppendSlice(f, reflect.ValueOf(args)))
+		return nil
+	}
+	if f.Kind() == reflect.Bool && len(args) == 0 {
+		f.SetBool(true)
+		return nil
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected a single value")
+	}
+
+	arg := args[0]
+	switch {
+	case f.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := caddy.ParseDuration(arg)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+	case f.Kind() == reflect.String:
+		f.SetString(arg)
+	case f.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(arg)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case f.CanInt():
+		n, err := strconv.ParseInt(arg, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case f.CanUint():
+		n, err := strconv.ParseUint(arg, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case f.CanFloat():
+		n, err := strconv.ParseFloat(arg, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("not supported in the Caddyfile")
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ caddyfile.Unmarshaler = (*Provider)(nil)
+	_ caddy.Provisioner     = (*Provider)(nil)
+)
@@ -0,0 +1,46 @@
+package caddy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/libdns/dnsupdate"
+)
+
+func TestReplacePlaceholders(t *testing.T) {
+	t.Setenv("DNSUPDATE_SECRET", "c2VjcmV0")
+	t.Setenv("DNSUPDATE_ZONE", "example.org.")
+
+	p := &dnsupdate.Provider{
+		Addr:  "{env.DNSUPDATE_ZONE}",
+		Addrs: []string{"tls://{env.DNSUPDATE_ZONE}"},
+		Zones: map[string]dnsupdate.ZoneConfig{
+			"{env.DNSUPDATE_ZONE}": {
+				Addrs: []string{"ns.{env.DNSUPDATE_ZONE}"},
+				Key:   &dnsupdate.TSIGKey{Name: "key.", Secret: "{env.DNSUPDATE_SECRET}"},
+			},
+		},
+		Views: map[string]dnsupdate.ZoneConfig{
+			"internal": {Addr: "internal.{env.DNSUPDATE_ZONE}"},
+		},
+	}
+	replacePlaceholders(caddy.NewReplacer(), reflect.ValueOf(p).Elem())
+
+	want := &dnsupdate.Provider{
+		Addr:  "example.org.",
+		Addrs: []string{"tls://example.org."},
+		Zones: map[string]dnsupdate.ZoneConfig{
+			"example.org.": {
+				Addrs: []string{"ns.example.org."},
+				Key:   &dnsupdate.TSIGKey{Name: "key.", Secret: "c2VjcmV0"},
+			},
+		},
+		Views: map[string]dnsupdate.ZoneConfig{
+			"internal": {Addr: "internal.example.org."},
+		},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("replacePlaceholders = %+v, want %+v", p, want)
+	}
+}
@@ -0,0 +1,78 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// PublishCDS publishes CDS and CDNSKEY records computed from the DNSKEY
+// records of the keys at the zone apex (RFC 7344), so that the parent zone
+// can update its DS records. They replace any existing CDS and CDNSKEY
+// records. The CDS records use the SHA-256 digest type unless other digest
+// types are specified.
+func (p *Provider) PublishCDS(ctx context.Context, zone string, keys []*dns.DNSKEY, digestTypes ...uint8) (err error) {
+	ctx, span := p.startSpan(ctx, "PublishCDS", zone)
+	defer func() { endSpan(span, err) }()
+
+	zone, err = p.resolveZone(zone)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return errors.New("no DNSKEY record to publish CDS records for")
+	}
+	if len(digestTypes) == 0 {
+		digestTypes = []uint8{dns.SHA256}
+	}
+
+	var rrs []dns.RR
+	for _, key := range keys {
+		// The digest covers the owner name of the key
+		key = dns.Copy(key).(*dns.DNSKEY)
+		key.Hdr.Name = zone
+		key.Hdr.Class = dns.ClassINET
+
+		for _, digestType := range digestTypes {
+			ds := key.ToDS(digestType)
+			if ds == nil {
+				return fmt.Errorf("unsupported DS digest type %v", digestType)
+			}
+			rrs = append(rrs, ds.ToCDS())
+		}
+		rrs = append(rrs, key.ToCDNSKEY())
+	}
+
+	var query dns.Msg
+	query.SetUpdate(zone)
+	query.RemoveRRset(cdsRRsets(zone))
+	query.Insert(rrs)
+	return p.sendAtomicUpdate(ctx, &query)
+}
+
+// WithdrawCDS removes the CDS and CDNSKEY records at the zone apex, once the
+// parent zone has picked them up.
+func (p *Provider) WithdrawCDS(ctx context.Context, zone string) (err error) {
+	ctx, span := p.startSpan(ctx, "WithdrawCDS", zone)
+	defer func() { endSpan(span, err) }()
+
+	zone, err = p.resolveZone(zone)
+	if err != nil {
+		return err
+	}
+
+	var query dns.Msg
+	query.SetUpdate(zone)
+	query.RemoveRRset(cdsRRsets(zone))
+	return p.sendAtomicUpdate(ctx, &query)
+}
+
+// cdsRRsets returns RRs identifying the CDS and CDNSKEY RRsets of a zone.
+func cdsRRsets(zone string) []dns.RR {
+	return []dns.RR{
+		&dns.ANY{Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeCDS}},
+		&dns.ANY{Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeCDNSKEY}},
+	}
+}
@@ -0,0 +1,142 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// HealthReport is the result of Check.
+type HealthReport struct {
+	Zone    string
+	Servers []ServerHealth
+}
+
+// ServerHealth reports the health of a server for a zone.
+type ServerHealth struct {
+	Addr string
+
+	// Round-trip time of the SOA query.
+	RTT time.Duration
+
+	// SOA serial of the zone served by the server.
+	Serial uint32
+
+	// Error of the SOA query, nil if the server is authoritative for the
+	// zone. The query is signed like updates, so rejected keys are reported
+	// here.
+	QueryError error
+
+	// Error of the no-op update, nil if the server accepts updates for the
+	// zone or if updates weren't checked.
+	UpdateError error
+}
+
+// Err returns the errors of all the servers, or nil if they're all healthy.
+func (r *HealthReport) Err() error {
+	var errs []error
+	for _, server := range r.Servers {
+		if server.QueryError != nil {
+			errs = append(errs, fmt.Errorf("server %v: %w", server.Addr, server.QueryError))
+		}
+		if server.UpdateError != nil {
+			errs = append(errs, fmt.Errorf("server %v: update failed: %w", server.Addr, server.UpdateError))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Check queries the SOA record of the zone from each server, to verify that
+// it's reachable, authoritative for the zone and accepts the key used to
+// sign messages. If update is true, it also sends an empty update, which
+// changes nothing but checks that the server accepts updates for the zone.
+// Updates aren't sent in dry-run mode.
+//
+// Problems with the servers are reported in the returned report, see
+// HealthReport.Err. The error is only set when no server could be checked.
+func (p *Provider) Check(ctx context.Context, zone string, update bool) (_ *HealthReport, err error) {
+	ctx, span := p.startSpan(ctx, "Check", zone)
+	defer func() { endSpan(span, err) }()
+
+	zone, err = p.resolveZone(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var query dns.Msg
+	query.SetQuestion(zone, dns.TypeSOA)
+	query.RecursionDesired = false
+	query.SetEdns0(p.udpSize(), false)
+
+	addrs, err := p.resolveServers(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &HealthReport{Zone: zone}
+	for _, addr := range addrs {
+		server := ServerHealth{Addr: addr}
+		start := time.Now()
+		reply, err := p.tryServers(ctx, []string{addr}, &query)
+		server.RTT = time.Since(start)
+		if err == nil {
+			server.Serial, err = replySerial(zone, reply)
+		}
+		server.QueryError = err
+
+		if update && !p.DryRun {
+			var msg dns.Msg
+			msg.SetUpdate(zone)
+			msg.SetEdns0(p.udpSize(), false)
+			_, server.UpdateError = p.tryServers(ctx, []string{addr}, &msg)
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		report.Servers = append(report.Servers, server)
+	}
+	return report, nil
+}
+
+// replySerial returns the SOA serial of a zone from an authoritative reply.
+func replySerial(zone string, reply *dns.Msg) (uint32, error) {
+	if !reply.Authoritative {
+		return 0, fmt.Errorf("server isn't authoritative for %v", zone)
+	}
+	for _, rr := range reply.Answer {
+		if soa, ok := rr.(*dns.SOA); ok && dns.CanonicalName(soa.Hdr.Name) == dns.CanonicalName(zone) {
+			return soa.Serial, nil
+		}
+	}
+	return 0, fmt.Errorf("no SOA record found for %v", zone)
+}
+
+// checkZoneHosted checks that the server is authoritative for a zone. When
+// the zone is a subdomain of a hosted zone, the error suggests it.
+func (p *Provider) checkZoneHosted(ctx context.Context, zone string) error {
+	var query dns.Msg
+	query.SetQuestion(zone, dns.TypeSOA)
+	query.RecursionDesired = false
+
+	reply, err := p.roundTrip(ctx, &query)
+	switch {
+	case errors.Is(err, ErrRefused) || errors.Is(err, ErrNotAuth) || errors.Is(err, ErrNXDomain):
+		return fmt.Errorf("%w: %v", ErrZoneNotHosted, zone)
+	case err != nil:
+		return fmt.Errorf("failed to check zone %v: %w", zone, err)
+	}
+
+	if _, err := replySerial(zone, reply); err == nil {
+		return nil
+	}
+	for _, rr := range reply.Ns {
+		if soa, ok := rr.(*dns.SOA); ok && reply.Authoritative {
+			return fmt.Errorf("%w: %v, did you mean %v?", ErrZoneNotHosted, zone, soa.Hdr.Name)
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrZoneNotHosted, zone)
+}
@@ -0,0 +1,98 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrCircuitOpen is returned when a server is skipped because of repeated
+// failures, see CircuitBreakerThreshold.
+var ErrCircuitOpen = errors.New("circuit breaker open after repeated failures")
+
+const defaultCircuitBreakerCooldown = 30 * time.Second
+
+func (p *Provider) circuitBreakerCooldown() time.Duration {
+	if p.CircuitBreakerCooldown > 0 {
+		return p.CircuitBreakerCooldown
+	}
+	return defaultCircuitBreakerCooldown
+}
+
+// circuit tracks the failures of a server.
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allowServer returns an error if the circuit of a server is open, unless
+// the cooldown is over and the message can be sent as a probe.
+func (p *Provider) allowServer(addr string) error {
+	if p.CircuitBreakerThreshold <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := p.circuits[addr]
+	if c == nil || c.failures < p.CircuitBreakerThreshold {
+		return nil
+	}
+	if c.probing || time.Now().Before(c.openUntil) {
+		return fmt.Errorf("server %v: %w", addr, ErrCircuitOpen)
+	}
+	c.probing = true
+	return nil
+}
+
+// recordResult updates the circuit of a server after an exchange. Only
+// failures showing that the server is unavailable are counted, and canceled
+// exchanges are ignored.
+func (p *Provider) recordResult(ctx context.Context, addr string, reply *dns.Msg, err error) {
+	if p.CircuitBreakerThreshold <= 0 {
+		return
+	}
+	failed := isTransient(err) || err == nil && reply.Rcode == dns.RcodeServerFailure
+
+	p.mu.Lock()
+	c := p.circuits[addr]
+	switch {
+	case ctx.Err() != nil:
+		if c != nil {
+			c.probing = false
+		}
+		p.mu.Unlock()
+		return
+	case !failed:
+		delete(p.circuits, addr)
+		p.mu.Unlock()
+		return
+	case c == nil:
+		c = new(circuit)
+		if p.circuits == nil {
+			p.circuits = make(map[string]*circuit)
+		}
+		p.circuits[addr] = c
+	}
+
+	c.failures++
+	c.probing = false
+	failures := c.failures
+	opened := failures >= p.CircuitBreakerThreshold
+	if opened {
+		c.openUntil = time.Now().Add(p.circuitBreakerCooldown())
+	}
+	p.mu.Unlock()
+
+	if opened && p.Logger != nil {
+		p.Logger.LogAttrs(ctx, slog.LevelWarn, "DNS server circuit breaker open",
+			slog.String("server", addr),
+			slog.Int("failures", failures),
+		)
+	}
+}
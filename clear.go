@@ -0,0 +1,86 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// errDestructive is returned by destructive operations unless they are
+// explicitly allowed.
+var errDestructive = errors.New("destructive operation refused, AllowDestructive isn't set")
+
+// ClearZone deletes all the records of the zone except the SOA and NS
+// records, for instance to rebuild a test zone from scratch. Delegations are
+// kept, along with their glue records, and so are the DNSSEC records
+// maintained by the server. It returns the records that were deleted.
+//
+// As a safety measure, AllowDestructive must be set.
+func (p *Provider) ClearZone(ctx context.Context, zone string) (_ []libdns.Record, err error) {
+	ctx, span := p.startSpan(ctx, "ClearZone", zone)
+	defer func() { endSpan(span, err) }()
+
+	if !p.AllowDestructive {
+		return nil, errDestructive
+	}
+
+	zone, err = p.resolveZone(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rrs, err := p.transferZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Names at or below a zone cut belong to another zone
+	var cuts []string
+	for _, rr := range rrs {
+		if hdr := rr.Header(); hdr.Rrtype == dns.TypeNS && dns.CanonicalName(hdr.Name) != dns.CanonicalName(zone) {
+			cuts = append(cuts, hdr.Name)
+		}
+	}
+
+	var (
+		deleted []dns.RR
+		rrsets  []dns.RR
+		seen    = make(map[rrsetKey]struct{})
+	)
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeSOA || hdr.Rrtype == dns.TypeNS || isDNSSECRR(rr) {
+			continue
+		}
+		if slices.ContainsFunc(cuts, func(cut string) bool { return dns.IsSubDomain(cut, hdr.Name) }) {
+			continue
+		}
+
+		deleted = append(deleted, rr)
+		key := rrsetKeyOf(rr)
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			rrsets = append(rrsets, rr)
+		}
+	}
+	if len(rrsets) == 0 {
+		return nil, nil
+	}
+
+	var query dns.Msg
+	query.SetUpdate(zone)
+	query.RemoveRRset(rrsets)
+	if err := ignoreQueued(p.update(ctx, &query)); err != nil {
+		return nil, err
+	}
+	return unmarshalRecords(zone, deleted), nil
+}
@@ -0,0 +1,524 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Default timeouts for network operations.
+const (
+	defaultDialTimeout  = 5 * time.Second
+	defaultReadTimeout  = 10 * time.Second
+	defaultWriteTimeout = 5 * time.Second
+)
+
+// defaultUDPSize is the default EDNS0 UDP buffer size, as recommended by the
+// DNS flag day 2020 to avoid IP fragmentation.
+const defaultUDPSize = 1232
+
+// servers returns the list of DNS server addresses, in order of preference.
+func (p *Provider) servers() []string {
+	var addrs []string
+	if p.Addr != "" {
+		addrs = append(addrs, normalizeServerAddr(p.Addr))
+	}
+	for _, addr := range p.Addrs {
+		addrs = append(addrs, normalizeServerAddr(addr))
+	}
+	return addrs
+}
+
+// normalizeServerAddr normalizes a configured server address.
+func normalizeServerAddr(addr string) string {
+	if isStampAddr(addr) {
+		return resolveStamp(addr)
+	}
+	return withDefaultPort(addr)
+}
+
+// withDefaultPort adds the default port of the transport to a server
+// address without one, including bare IPv6 addresses such as "::1".
+func withDefaultPort(addr string) string {
+	if isHTTPSAddr(addr) || isUnixAddr(addr) {
+		return addr
+	}
+
+	port := "53"
+	if isQUICAddr(addr) || isTLSAddr(addr) {
+		port = "853"
+	}
+	hostport := trimTransport(addr)
+	prefix := strings.TrimSuffix(addr, hostport)
+	if host := strings.Trim(hostport, "[]"); isIPAddr(host) {
+		return prefix + net.JoinHostPort(host, port)
+	}
+
+	var addrErr *net.AddrError
+	if _, _, err := net.SplitHostPort(hostport); errors.As(err, &addrErr) && addrErr.Err == "missing port in address" {
+		return prefix + net.JoinHostPort(hostport, port)
+	}
+	return addr
+}
+
+func (p *Provider) roundTrip(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	addrs, err := p.resolveServers(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.IsEdns0() == nil {
+		query = query.Copy()
+		query.SetEdns0(p.udpSize(), false)
+	}
+
+	if query.Opcode == dns.OpcodeUpdate && p.ReplicationPolicy != "" {
+		return p.replicate(ctx, addrs, query)
+	}
+
+	reply, err := p.retryServers(ctx, addrs, query)
+	if isNotAuthoritative(err) && query.Opcode == dns.OpcodeUpdate && ctx.Err() == nil {
+		// The configured servers may be secondaries, send the update to the
+		// primary server of the zone instead
+		if primaries := p.otherPrimaryServers(ctx, query, addrs); len(primaries) > 0 {
+			return p.retryServers(ctx, primaries, query)
+		}
+	}
+	return reply, err
+}
+
+// retryServers sends the query to the servers, retrying with backoff when
+// all of them fail with a transient error.
+func (p *Provider) retryServers(ctx context.Context, addrs []string, query *dns.Msg) (*dns.Msg, error) {
+	backoff := p.retryBackoff()
+	for attempt := 1; ; attempt++ {
+		reply, err := p.tryServers(ctx, addrs, query)
+		if err == nil || attempt >= p.maxAttempts() || ctx.Err() != nil || !isTransient(err) {
+			return reply, err
+		}
+
+		if err := sleep(ctx, jitter(backoff)); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// otherPrimaryServers returns the addresses of the primary server of the
+// zone of a query, excluding the servers already tried. Lookup failures are
+// ignored.
+func (p *Provider) otherPrimaryServers(ctx context.Context, query *dns.Msg, tried []string) []string {
+	if len(query.Question) == 0 {
+		return nil
+	}
+
+	primaries, err := p.primaryServers(ctx, query.Question[0].Name)
+	if err != nil {
+		return nil
+	}
+	return slices.DeleteFunc(slices.Clone(primaries), func(addr string) bool {
+		return slices.Contains(tried, addr)
+	})
+}
+
+// isNotAuthoritative returns true if the error reports that the server
+// isn't allowed to handle the query, such as a secondary server refusing
+// updates.
+func isNotAuthoritative(err error) bool {
+	return errors.Is(err, ErrRefused) || errors.Is(err, ErrNotAuth)
+}
+
+// resolveServers returns the addresses of the servers to send the query to.
+func (p *Provider) resolveServers(ctx context.Context, query *dns.Msg) ([]string, error) {
+	var addrs []string
+	if len(query.Question) > 0 {
+		addrs = p.zoneServers(query.Question[0].Name)
+	} else {
+		addrs = p.servers()
+	}
+	view, err := p.viewConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if servers := view.servers(); len(servers) > 0 {
+		addrs = servers
+	}
+	if servers := callOptionsFrom(ctx).servers; len(servers) > 0 {
+		addrs = make([]string, len(servers))
+		for i, addr := range servers {
+			if isStampAddr(addr) {
+				return nil, fmt.Errorf("DNS stamp %q not supported with WithServer", addr)
+			}
+			addrs[i] = withDefaultPort(addr)
+		}
+	}
+	if len(addrs) == 0 && p.UseSystemResolver {
+		var err error
+		addrs, err = systemServers()
+		if err != nil {
+			return nil, err
+		}
+	} else if len(addrs) == 0 && len(query.Question) > 0 {
+		var err error
+		addrs, err = p.primaryServers(ctx, query.Question[0].Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover primary server: %w", err)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no DNS server address configured")
+	}
+	return addrs, nil
+}
+
+// tryServers sends the query to each server in turn, until one of them
+// replies without failing.
+func (p *Provider) tryServers(ctx context.Context, addrs []string, query *dns.Msg) (*dns.Msg, error) {
+	var zone string
+	if len(query.Question) > 0 {
+		zone = query.Question[0].Name
+	}
+
+	var err error
+	for _, addr := range addrs {
+		var s signer
+		s, err = p.signer(ctx, addr, zone)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err = p.allowServer(addr); err != nil {
+			continue
+		}
+
+		start := time.Now()
+		var reply *dns.Msg
+		reply, err = p.observedExchange(ctx, addr, query, s)
+		if key, ok := s.(*tsigKey); ok && err == nil && replyTSIGError(reply) != nil {
+			reply, err = p.retryTSIG(ctx, addr, query, reply, key)
+		}
+		p.recordResult(ctx, addr, reply, err)
+
+		exchangeErr := func(err error) error {
+			return &ExchangeError{Server: addr, Query: query, Reply: reply, Duration: time.Since(start), Err: err}
+		}
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			err = exchangeErr(err)
+		case replyTSIGError(reply) != nil:
+			return nil, exchangeErr(replyTSIGError(reply))
+		case reply.Rcode == dns.RcodeServerFailure || reply.Rcode == dns.RcodeRefused || reply.Rcode == dns.RcodeNotAuth:
+			// Another server may be able to handle the query
+			err = exchangeErr(RcodeError(reply.Rcode))
+		case reply.Rcode != dns.RcodeSuccess:
+			return nil, exchangeErr(RcodeError(reply.Rcode))
+		default:
+			return reply, nil
+		}
+	}
+	return nil, err
+}
+
+// observedExchange sends a query to a single server like exchange, and
+// records the exchange in traces, logs, dumps and metrics.
+func (p *Provider) observedExchange(ctx context.Context, addr string, query *dns.Msg, s signer) (*dns.Msg, error) {
+	if timeout := callOptionsFrom(ctx).timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	spanCtx, span := p.startExchangeSpan(ctx, addr, query)
+	p.dumpMsg("sent to", addr, query)
+	reply, err := p.exchangeWithMiddleware(spanCtx, addr, query, s)
+	p.dumpMsg("received from", addr, reply)
+	endExchangeSpan(span, reply, err)
+	duration := time.Since(start)
+	p.logExchange(ctx, addr, query, reply, err, duration)
+	p.Metrics.observe(query, reply, err, duration)
+	return reply, err
+}
+
+// logExchange logs the outcome of an exchange with a server.
+func (p *Provider) logExchange(ctx context.Context, addr string, query, reply *dns.Msg, err error, duration time.Duration) {
+	if p.Logger == nil {
+		return
+	}
+
+	attrs := []slog.Attr{slog.String("server", addr)}
+	if len(query.Question) > 0 {
+		attrs = append(attrs, slog.String("zone", query.Question[0].Name))
+	}
+	attrs = append(attrs,
+		slog.String("opcode", dns.OpcodeToString[query.Opcode]),
+		slog.Duration("duration", duration),
+	)
+	if query.Opcode == dns.OpcodeUpdate {
+		attrs = append(attrs, slog.Int("records", len(query.Ns)))
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+		p.Logger.LogAttrs(ctx, slog.LevelInfo, "DNS exchange failed", attrs...)
+		return
+	}
+
+	attrs = append(attrs,
+		slog.String("rcode", dns.RcodeToString[reply.Rcode]),
+		slog.Int("answers", len(reply.Answer)),
+	)
+	for _, ede := range extendedErrors(reply) {
+		attrs = append(attrs, slog.String("ede", formatEDE(ede)))
+	}
+	level := slog.LevelDebug
+	if reply.Rcode != dns.RcodeSuccess {
+		level = slog.LevelInfo
+	}
+	p.Logger.LogAttrs(ctx, level, "DNS exchange", attrs...)
+}
+
+// trimTransport removes the prefix selecting the transport from a server
+// address, leaving the host and port.
+func trimTransport(addr string) string {
+	for _, prefix := range []string{"quic://", "tls://"} {
+		if hostport, ok := strings.CutPrefix(addr, prefix); ok {
+			return hostport
+		}
+	}
+	return addr
+}
+
+// exchange sends a query to a single server, using the transport selected by
+// the address. The query is signed with the given signer, if any.
+func (p *Provider) exchange(ctx context.Context, addr string, query *dns.Msg, s signer) (*dns.Msg, error) {
+	if err := p.waitRateLimit(ctx, addr); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case isHTTPSAddr(addr):
+		return p.exchangeHTTPS(ctx, addr, query, s)
+	case isQUICAddr(addr):
+		return p.exchangeQUIC(ctx, addr, query, s)
+	case isTLSAddr(addr):
+		addr = strings.TrimPrefix(addr, "tls://")
+		if isTransfer(query) {
+			return p.exchangeTransfer(ctx, "tls", addr, query, s)
+		}
+		return p.exchangeConn(ctx, "tls", addr, query, s)
+	case isStampAddr(addr):
+		// Only invalid stamps are left unresolved
+		_, err := parseStamp(addr)
+		return nil, err
+	case isUnixAddr(addr):
+		// Messages are framed as over TCP on stream sockets
+		addr = strings.TrimPrefix(addr, "unix:")
+		if isTransfer(query) {
+			return p.exchangeTransfer(ctx, "unix", addr, query, s)
+		}
+		return p.exchangeConn(ctx, "unix", addr, query, s)
+	default:
+		return p.exchangeWithCookie(ctx, addr, query, s)
+	}
+}
+
+// exchangeDNS sends a query to a plain DNS server.
+func (p *Provider) exchangeDNS(ctx context.Context, addr string, query *dns.Msg, s signer) (*dns.Msg, error) {
+	// Zone transfers are only defined over TCP
+	if isTransfer(query) {
+		return p.exchangeTransfer(ctx, "tcp", addr, query, s)
+	}
+
+	if p.UDP && query.Len() <= int(p.udpSize()) {
+		reply, err := p.exchangeConn(ctx, "udp", addr, query, s)
+		if err != nil || !reply.Truncated {
+			return reply, err
+		}
+	}
+
+	return p.exchangeConn(ctx, "tcp", addr, query, s)
+}
+
+// exchangeConn sends a query over a connection. Stream connections are
+// pooled and re-used across queries.
+func (p *Provider) exchangeConn(ctx context.Context, network, addr string, query *dns.Msg, s signer) (*dns.Msg, error) {
+	if network == "udp" {
+		conn, err := p.dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+
+		return p.exchangeWithConn(ctx, conn, query, s)
+	}
+
+	if network == "tcp" || network == "tls" {
+		query = withKeepalive(query)
+	}
+
+	for {
+		conn, reused, err := p.getConn(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		reply, err := p.exchangeWithConn(ctx, conn, query, s)
+		if err != nil {
+			conn.Close()
+			// The server may have closed an idle connection in the meantime,
+			// try again with another one
+			if reused && ctx.Err() == nil {
+				continue
+			}
+			return nil, err
+		}
+
+		p.putConn(network, addr, conn, keepaliveTimeout(reply))
+		return reply, nil
+	}
+}
+
+// exchangeWithConn sends a query over an established connection.
+func (p *Provider) exchangeWithConn(ctx context.Context, conn net.Conn, query *dns.Msg, s signer) (*dns.Msg, error) {
+	buf, sig, err := packMsg(query, s)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	conn.SetWriteDeadline(now.Add(p.writeTimeout()))
+	conn.SetReadDeadline(now.Add(p.readTimeout()))
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	// dns.Conn takes care of framing messages on stream connections
+	co := &dns.Conn{Conn: conn}
+	if _, err := co.Write(buf); err != nil {
+		return nil, err
+	}
+
+	buf = make([]byte, dns.MaxMsgSize)
+	for {
+		n, err := co.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		reply, err := unpackReply(buf[:n], s, sig)
+		if err != nil {
+			return nil, err
+		}
+		if reply.Id != query.Id {
+			// Ignore replies with mismatched IDs over UDP, since they might
+			// be replies to earlier queries that timed out
+			if strings.HasPrefix(conn.LocalAddr().Network(), "udp") {
+				continue
+			}
+			return nil, dns.ErrId
+		}
+		return reply, nil
+	}
+}
+
+// dial connects to a DNS server, using the custom dial function if any.
+func (p *Provider) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.dialTimeout())
+	defer cancel()
+
+	if network == "tls" {
+		return p.dialTLS(ctx, addr)
+	}
+	addr = p.stampDialAddr(addr)
+
+	if p.DialContext != nil {
+		return p.DialContext(ctx, network, addr)
+	}
+
+	localAddr, err := p.localAddr(network)
+	if err != nil {
+		return nil, err
+	}
+	dialer := net.Dialer{LocalAddr: localAddr}
+	if host, _, err := net.SplitHostPort(addr); err == nil && !isIPAddr(host) && network != "unix" {
+		return p.dialHost(ctx, &dialer, network, addr)
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+func (p *Provider) udpSize() uint16 {
+	if p.UDPSize > 0 {
+		return p.UDPSize
+	}
+	return defaultUDPSize
+}
+
+func (p *Provider) dialTimeout() time.Duration {
+	if p.DialTimeout > 0 {
+		return p.DialTimeout
+	}
+	return defaultDialTimeout
+}
+
+func (p *Provider) readTimeout() time.Duration {
+	if p.ReadTimeout > 0 {
+		return p.ReadTimeout
+	}
+	return defaultReadTimeout
+}
+
+func (p *Provider) writeTimeout() time.Duration {
+	if p.WriteTimeout > 0 {
+		return p.WriteTimeout
+	}
+	return defaultWriteTimeout
+}
+
+// localAddr returns the local address to send traffic from, if any.
+func (p *Provider) localAddr(network string) (net.Addr, error) {
+	if p.LocalAddr == "" {
+		return nil, nil
+	}
+
+	ip := net.ParseIP(p.LocalAddr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid local address %q", p.LocalAddr)
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return &net.TCPAddr{IP: ip}, nil
+	case "udp", "udp4", "udp6":
+		return &net.UDPAddr{IP: ip}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func isUnixAddr(addr string) bool {
+	return strings.HasPrefix(addr, "unix:")
+}
+
+func isTransfer(msg *dns.Msg) bool {
+	for _, q := range msg.Question {
+		if q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR {
+			return true
+		}
+	}
+	return false
+}
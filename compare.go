@@ -0,0 +1,172 @@
+package dnsupdate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// ZoneComparison is the result of Compare.
+type ZoneComparison struct {
+	Zone    string
+	Servers []ServerZone
+
+	// Records not served by all the servers which could be compared, in the
+	// order they were first found.
+	Differences []RecordDifference
+}
+
+// ServerZone reports the state of a zone on a server.
+type ServerZone struct {
+	Addr string
+
+	// SOA serial of the zone served by the server.
+	Serial uint32
+
+	// Number of records listed, not counting the SOA record.
+	Records int
+
+	// Error listing the records of the zone, in which case the server isn't
+	// compared with the others.
+	Err error
+}
+
+// RecordDifference is a record served by some servers but not others.
+type RecordDifference struct {
+	Record libdns.Record
+
+	// Servers serving the record, and servers missing it.
+	Present []string
+	Missing []string
+}
+
+// InSync returns true if all the servers which could be compared serve the
+// same records with the same serial.
+func (c *ZoneComparison) InSync() bool {
+	return len(c.Differences) == 0 && c.SerialSkew() == 0
+}
+
+// SerialSkew returns how far the oldest serial is behind the newest one,
+// using serial number arithmetic, among the servers which could be
+// compared.
+func (c *ZoneComparison) SerialSkew() uint32 {
+	var (
+		newest, oldest uint32
+		found          bool
+	)
+	for _, server := range c.Servers {
+		switch {
+		case server.Err != nil:
+		case !found:
+			newest, oldest, found = server.Serial, server.Serial, true
+		case serialGreater(server.Serial, newest):
+			newest = server.Serial
+		case serialGreater(oldest, server.Serial):
+			oldest = server.Serial
+		}
+	}
+	return newest - oldest
+}
+
+// Compare lists the records of the zone from each of the given servers,
+// such as "192.0.2.1:53", or from the name servers of the zone, as listed in
+// its NS records, and reports the records which aren't served by all of
+// them and how far behind their serials are, for instance to find
+// secondary servers whose zone transfers are stuck. The records are listed
+// with zone transfers, or with the queries set by LookupNames when servers
+// refuse them. SOA records are only compared by their serials.
+//
+// Servers which couldn't be compared are reported in the returned
+// comparison. The error is only set when the servers couldn't be found.
+func (p *Provider) Compare(ctx context.Context, zone string, servers ...string) (_ *ZoneComparison, err error) {
+	ctx, span := p.startSpan(ctx, "Compare", zone)
+	defer func() { endSpan(span, err) }()
+
+	zone, err = p.resolveZone(zone)
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		servers, err = p.nameServers(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		comparison = &ZoneComparison{Zone: zone}
+		ids        []string
+		records    = make(map[string]libdns.Record)
+		served     = make(map[string][]string)
+		compared   []string
+	)
+	for _, addr := range servers {
+		addr = withDefaultPort(addr)
+		server := ServerZone{Addr: addr}
+		rrs, err := p.serverZone(WithServer(ctx, addr), zone)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			server.Err = err
+			comparison.Servers = append(comparison.Servers, server)
+			continue
+		}
+
+		for _, rr := range dedupRRs(rrs) {
+			if soa, ok := rr.(*dns.SOA); ok && dns.CanonicalName(soa.Hdr.Name) == dns.CanonicalName(zone) {
+				server.Serial = soa.Serial
+				continue
+			}
+			id, err := rrID(rr)
+			if err != nil {
+				continue
+			}
+			if _, ok := records[id]; !ok {
+				ids = append(ids, id)
+				records[id] = unmarshalRecord(zone, rr)
+			}
+			served[id] = append(served[id], addr)
+			server.Records++
+		}
+		compared = append(compared, addr)
+		comparison.Servers = append(comparison.Servers, server)
+	}
+
+	for _, id := range ids {
+		if len(served[id]) == len(compared) {
+			continue
+		}
+		missing := slices.DeleteFunc(slices.Clone(compared), func(addr string) bool {
+			return slices.Contains(served[id], addr)
+		})
+		comparison.Differences = append(comparison.Differences, RecordDifference{
+			Record:  records[id],
+			Present: served[id],
+			Missing: missing,
+		})
+	}
+	return comparison, nil
+}
+
+// serverZone lists the records of a zone, including its SOA record, from
+// the server set in the context.
+func (p *Provider) serverZone(ctx context.Context, zone string) ([]dns.RR, error) {
+	rrs, err := p.axfr(ctx, zone)
+	if !isNotAuthoritative(err) || len(p.LookupNames) == 0 {
+		return rrs, err
+	}
+
+	soa, err := p.lookupRRset(ctx, zone, dns.TypeSOA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query SOA record: %w", err)
+	}
+	rrs, err = p.lookupRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return append(soa, rrs...), nil
+}
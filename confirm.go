@@ -0,0 +1,53 @@
+package dnsupdate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// ChangeSet describes the changes of an operation, passed to ConfirmFunc.
+type ChangeSet struct {
+	Zone string
+
+	// Records added by the update.
+	Added []libdns.Record
+
+	// Records deleted by the update. Deletions of whole RRsets or names are
+	// generic libdns.RR records without data, and without type for names.
+	Deleted []libdns.Record
+
+	// Update message with all the changes, before signing and splitting.
+	Msg *dns.Msg
+}
+
+// confirmUpdate calls ConfirmFunc with the changes of an update deleting
+// records, before any part of it is sent.
+func (p *Provider) confirmUpdate(ctx context.Context, msg *dns.Msg) error {
+	if p.ConfirmFunc == nil {
+		return nil
+	}
+
+	changes := ChangeSet{Zone: msg.Question[0].Name, Msg: msg}
+	var added, deleted []dns.RR
+	for _, rr := range msg.Ns {
+		switch rr.Header().Class {
+		case dns.ClassANY, dns.ClassNONE:
+			deleted = append(deleted, rr)
+		default:
+			added = append(added, rr)
+		}
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+	changes.Added = unmarshalSentRecords(changes.Zone, added)
+	changes.Deleted = unmarshalSentRecords(changes.Zone, deleted)
+
+	if err := p.ConfirmFunc(ctx, changes); err != nil {
+		return fmt.Errorf("update of %v not confirmed: %w", changes.Zone, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package dnsupdate_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/libdns/dnsupdate"
+)
+
+func TestConfirmFunc(t *testing.T) {
+	srv, p := newTestServer(t)
+	ctx := context.Background()
+
+	if _, err := p.AppendRecords(ctx, testZone, txtRecords(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []dnsupdate.ChangeSet
+	errDenied := errors.New("denied")
+	p.ConfirmFunc = func(ctx context.Context, c dnsupdate.ChangeSet) error {
+		changes = append(changes, c)
+		return errDenied
+	}
+	_, err := p.DeleteRecords(ctx, testZone, txtRecords(1))
+	if !errors.Is(err, errDenied) {
+		t.Errorf("DeleteRecords error = %v, want %v", err, errDenied)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("ConfirmFunc called %d times, want 1", len(changes))
+	}
+	if c := changes[0]; c.Zone != testZone || len(c.Added) != 0 || len(c.Deleted) != 1 {
+		t.Errorf("ConfirmFunc called with zone %v, %d added and %d deleted records, want %v, 0 and 1", c.Zone, len(c.Added), len(c.Deleted), testZone)
+	}
+	if got := serverRecords(srv); len(got) != 2 {
+		t.Errorf("server holds %d records after a denied update, want 2", len(got))
+	}
+
+	// Updates only adding records aren't confirmed
+	changes = nil
+	if _, err := p.AppendRecords(ctx, testZone, txtRecords(3)[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("ConfirmFunc called %d times for an addition, want 0", len(changes))
+	}
+}
+
+func TestConfirmFuncSplit(t *testing.T) {
+	srv, p := newTestServer(t)
+	p.MaxMessageSize = 2000
+	ctx := context.Background()
+
+	recs := txtRecords(200)
+	if _, err := p.AppendRecords(ctx, testZone, recs); err != nil {
+		t.Fatal(err)
+	}
+
+	// The whole update is confirmed once, before any part of it is sent
+	var calls, updates int
+	p.Middleware = []dnsupdate.Middleware{countUpdates(&updates)}
+	p.ConfirmFunc = func(ctx context.Context, c dnsupdate.ChangeSet) error {
+		calls++
+		if len(c.Deleted) != len(recs) {
+			t.Errorf("ConfirmFunc called with %d deleted records, want %d", len(c.Deleted), len(recs))
+		}
+		return nil
+	}
+	if _, err := p.DeleteRecords(ctx, testZone, recs); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 || updates < 2 {
+		t.Errorf("ConfirmFunc called %d times for %d update messages, want once for several", calls, updates)
+	}
+	if got := serverRecords(srv); len(got) != 0 {
+		t.Errorf("server holds %d records, want none", len(got))
+	}
+}
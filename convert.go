@@ -0,0 +1,29 @@
+package dnsupdate
+
+import (
+	"fmt"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// ToRR converts a record to a miekg/dns RR, the way records are sent to
+// servers. The name of the record is made absolute in the zone, and
+// internationalized names are converted to their ASCII form.
+func ToRR(zone string, record libdns.Record) (dns.RR, error) {
+	rr, err := marshalRecord(zone, record)
+	if err != nil {
+		r := record.RR()
+		return nil, fmt.Errorf("invalid %v record %q: %w", r.Type, r.Name, err)
+	}
+	return rr, nil
+}
+
+// FromRR converts a miekg/dns RR to a record, the way records received from
+// servers are returned: records of the types supported by libdns are
+// converted to their specific type, such as libdns.TXT, and other records
+// to a generic libdns.RR. The name of the record is made relative to the
+// zone.
+func FromRR(zone string, rr dns.RR) libdns.Record {
+	return unmarshalRecord(zone, rr)
+}
@@ -0,0 +1,94 @@
+package dnsupdate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// dnsCookie holds the DNS cookies exchanged with a server, as defined in
+// RFC 7873, encoded in hexadecimal.
+type dnsCookie struct {
+	client string
+	server string
+}
+
+// exchangeWithCookie sends a query to a plain DNS server along with a DNS
+// cookie, which lets the server tell legitimate clients apart from spoofed
+// traffic.
+func (p *Provider) exchangeWithCookie(ctx context.Context, addr string, query *dns.Msg, s signer) (*dns.Msg, error) {
+	if p.DisableCookies || query.IsEdns0() == nil {
+		return p.exchangeDNS(ctx, addr, query, s)
+	}
+
+	for attempt := 1; ; attempt++ {
+		cookie := p.cookie(addr)
+
+		q := query.Copy()
+		opt := q.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{
+			Code:   dns.EDNS0COOKIE,
+			Cookie: cookie.client + cookie.server,
+		})
+
+		reply, err := p.exchangeDNS(ctx, addr, q, s)
+		if err != nil {
+			return nil, err
+		}
+		p.updateCookie(addr, cookie.client, reply)
+
+		// The server rejected our cookie but sent a fresh one, retry once
+		// with it, see RFC 7873 section 5.3
+		if reply.Rcode == dns.RcodeBadCookie && attempt == 1 {
+			continue
+		}
+		return reply, nil
+	}
+}
+
+// cookie returns the DNS cookie to send to a server. The client cookie is
+// generated randomly for each server.
+func (p *Provider) cookie(addr string) dnsCookie {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cookie, ok := p.cookies[addr]; ok {
+		return cookie
+	}
+
+	var client [8]byte
+	rand.Read(client[:])
+	cookie := dnsCookie{client: hex.EncodeToString(client[:])}
+	if p.cookies == nil {
+		p.cookies = make(map[string]dnsCookie)
+	}
+	p.cookies[addr] = cookie
+	return cookie
+}
+
+// updateCookie stores the server cookie sent in a reply, if it echoes the
+// client cookie.
+func (p *Provider) updateCookie(addr, clientCookie string, reply *dns.Msg) {
+	opt := reply.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	for _, option := range opt.Option {
+		cookie, ok := option.(*dns.EDNS0_COOKIE)
+		if !ok || len(cookie.Cookie) <= len(clientCookie) || !strings.EqualFold(cookie.Cookie[:len(clientCookie)], clientCookie) {
+			continue
+		}
+
+		p.mu.Lock()
+		p.cookies[addr] = dnsCookie{
+			client: clientCookie,
+			server: cookie.Cookie[len(clientCookie):],
+		}
+		p.mu.Unlock()
+		return
+	}
+}
@@ -0,0 +1,122 @@
+package dnsupdate
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// defaultFallbackDelay is the default delay before trying the other address
+// family, as recommended by RFC 8305.
+const defaultFallbackDelay = 300 * time.Millisecond
+
+func (p *Provider) fallbackDelay() time.Duration {
+	if p.FallbackDelay > 0 {
+		return p.FallbackDelay
+	}
+	return defaultFallbackDelay
+}
+
+// familyNetworks returns the networks to dial for a server, in order of
+// preference, according to the address family settings.
+func (p *Provider) familyNetworks(network string) ([]string, error) {
+	suffix := map[string]string{"ipv4": "4", "ipv6": "6"}
+	if p.AddressFamily != "" {
+		s, ok := suffix[p.AddressFamily]
+		if !ok {
+			return nil, fmt.Errorf("invalid address family %q, expected ipv4 or ipv6", p.AddressFamily)
+		}
+		return []string{network + s}, nil
+	}
+
+	switch p.PreferredAddressFamily {
+	case "":
+		return []string{network}, nil
+	case "ipv4":
+		return []string{network + "4", network + "6"}, nil
+	case "ipv6":
+		return []string{network + "6", network + "4"}, nil
+	default:
+		return nil, fmt.Errorf("invalid preferred address family %q, expected ipv4 or ipv6", p.PreferredAddressFamily)
+	}
+}
+
+// dialHost connects to a server given by host name, with the address family
+// settings. Over TCP, the other address family is tried in parallel if the
+// preferred one doesn't connect quickly enough (happy eyeballs, RFC 8305).
+// Over UDP, connecting doesn't tell whether the server is reachable, so the
+// other address family is only used if the preferred one has no address.
+func (p *Provider) dialHost(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	networks, err := p.familyNetworks(network)
+	if err != nil {
+		return nil, err
+	} else if len(networks) == 1 {
+		return dialer.DialContext(ctx, networks[0], addr)
+	}
+
+	if network != "tcp" {
+		conn, err := dialer.DialContext(ctx, networks[0], addr)
+		if err != nil && ctx.Err() == nil {
+			return dialer.DialContext(ctx, networks[1], addr)
+		}
+		return conn, err
+	}
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan result, len(networks))
+	start := func(network string) {
+		go func() {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			results <- result{conn, err}
+		}()
+	}
+
+	start(networks[0])
+	pending, next := 1, 1
+	timer := time.NewTimer(p.fallbackDelay())
+	defer timer.Stop()
+
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if next < len(networks) {
+				start(networks[next])
+				pending++
+				next++
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// Close the connections established too late
+				go func(pending int) {
+					for range pending {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if next < len(networks) {
+				// Don't wait for the delay after a failure
+				timer.Stop()
+				start(networks[next])
+				pending++
+				next++
+			} else if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package dnsupdate
+
+import (
+	"context"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// rrsetKey identifies a RRset.
+type rrsetKey struct {
+	name  string
+	rtype uint16
+}
+
+func rrsetKeyOf(rr dns.RR) rrsetKey {
+	return rrsetKey{dns.CanonicalName(rr.Header().Name), rr.Header().Rrtype}
+}
+
+// dedupRRs removes the duplicates of RRs, keeping the first occurrence of
+// each. Names are compared case-insensitively, and TTLs are ignored.
+func dedupRRs(rrs []dns.RR) []dns.RR {
+	seen := make(map[rrsetKey][]dns.RR)
+	deduped := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		key := rrsetKeyOf(rr)
+		if slices.ContainsFunc(seen[key], func(s dns.RR) bool { return isDuplicateRR(s, rr) }) {
+			continue
+		}
+		seen[key] = append(seen[key], rr)
+		deduped = append(deduped, rr)
+	}
+	return deduped
+}
+
+// isDuplicateRR is like dns.IsDuplicate, but also handles the RRs deleting
+// RRsets or names in updates, which have no data.
+func isDuplicateRR(a, b dns.RR) bool {
+	if a.Header().Class == dns.ClassANY || b.Header().Class == dns.ClassANY {
+		return a.Header().Class == b.Header().Class && rrsetKeyOf(a) == rrsetKeyOf(b)
+	}
+	return dns.IsDuplicate(a, b)
+}
+
+// diffRRsets compares the RRsets of the given RRs to the current records of
+// the zone, and returns the RRs to remove and to add so that these RRsets
+// contain exactly the given RRs.
+func (p *Provider) diffRRsets(ctx context.Context, zone string, rrs []dns.RR) (remove, add []dns.RR, err error) {
+	current, err := p.transferZone(ctx, zone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := make(map[rrsetKey]struct{}, len(rrs))
+	for _, rr := range rrs {
+		keys[rrsetKeyOf(rr)] = struct{}{}
+	}
+
+	var existing []dns.RR
+	for _, rr := range current {
+		if _, ok := keys[rrsetKeyOf(rr)]; ok {
+			existing = append(existing, rr)
+		}
+	}
+
+	// Records with a different TTL are added again, which updates the TTL
+	// of the RRset
+	for _, rr := range rrs {
+		if !slices.ContainsFunc(existing, func(e dns.RR) bool { return sameRR(e, rr) }) {
+			add = append(add, rr)
+		}
+	}
+	for _, rr := range existing {
+		if !slices.ContainsFunc(rrs, func(r dns.RR) bool { return dns.IsDuplicate(r, rr) }) {
+			// Copy the RR, since removing it changes its header
+			remove = append(remove, dns.Copy(rr))
+		}
+	}
+	return remove, add, nil
+}
+
+// sameRR returns true if two RRs have the same data and TTL.
+func sameRR(a, b dns.RR) bool {
+	return dns.IsDuplicate(a, b) && a.Header().Ttl == b.Header().Ttl
+}
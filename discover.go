@@ -0,0 +1,175 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const resolvConfPath = "/etc/resolv.conf"
+
+// minPrimaryTTL is the minimum time for which the primary server of a zone
+// is cached, so that zones with short SOA TTLs aren't looked up for every
+// message.
+const minPrimaryTTL = time.Minute
+
+// primaryServer holds the address of the primary name server of a zone.
+type primaryServer struct {
+	addrs   []string
+	expires time.Time
+}
+
+// primaryServers looks up the address of the primary name server of the zone
+// of a name, as advertised in the MNAME field of its SOA record. This mimics
+// the behavior of nsupdate when no server is specified. The name of the
+// server is resolved when connecting to it, like other server names.
+//
+// The servers are cached for each zone for the TTL of its SOA record, but
+// the zone of names below the apex is looked up every time, since it may
+// have been delegated.
+func (p *Provider) primaryServers(ctx context.Context, name string) ([]string, error) {
+	name = dns.CanonicalName(name)
+	if addrs, ok := p.cachedPrimaryServers(name); ok {
+		return addrs, nil
+	}
+
+	soa, err := p.lookupSOA(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	zone := dns.CanonicalName(soa.Hdr.Name)
+	if addrs, ok := p.cachedPrimaryServers(zone); ok {
+		return addrs, nil
+	}
+
+	addrs := []string{net.JoinHostPort(strings.TrimSuffix(soa.Ns, "."), "53")}
+	ttl := max(time.Duration(soa.Hdr.Ttl)*time.Second, minPrimaryTTL)
+	p.mu.Lock()
+	if p.primaries == nil {
+		p.primaries = make(map[string]*primaryServer)
+	}
+	p.primaries[zone] = &primaryServer{addrs: addrs, expires: time.Now().Add(ttl)}
+	p.mu.Unlock()
+
+	return addrs, nil
+}
+
+// cachedPrimaryServers returns the cached primary servers of a zone, unless
+// they expired.
+func (p *Provider) cachedPrimaryServers(zone string) ([]string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	primary := p.primaries[zone]
+	if primary == nil || time.Now().After(primary.expires) {
+		return nil, false
+	}
+	return primary.addrs, true
+}
+
+// systemResolverConfig reads the system resolver configuration.
+func systemResolverConfig() (*dns.ClientConfig, error) {
+	conf, err := dns.ClientConfigFromFile(resolvConfPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resolver configuration: %w", err)
+	}
+	return conf, nil
+}
+
+// systemServers returns the addresses of the name servers from the system
+// resolver configuration.
+func systemServers() ([]string, error) {
+	conf, err := systemResolverConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, len(conf.Servers))
+	for i, server := range conf.Servers {
+		addrs[i] = net.JoinHostPort(server, conf.Port)
+	}
+	return addrs, nil
+}
+
+// resolveZone returns the zone to operate on. If no zone is specified and
+// the system resolver is enabled, the first search domain is used.
+func (p *Provider) resolveZone(zone string) (string, error) {
+	if zone != "" || !p.UseSystemResolver {
+		return toASCII(zone)
+	}
+
+	conf, err := systemResolverConfig()
+	if err != nil {
+		return "", err
+	} else if len(conf.Search) == 0 {
+		return "", errors.New("no zone specified and no search domain found in resolver configuration")
+	}
+	return dns.Fqdn(conf.Search[0]), nil
+}
+
+// lookupSOA queries the name servers of the system resolver configuration for
+// the SOA record of the zone of a name, connecting to them like to other
+// servers. The SOA record is taken from the answer for the apex, or from the
+// authority section of the negative answer for other names, and the parent
+// domains are queried if neither holds it. The servers are queried over UDP
+// like by the system resolver, regardless of the UDP setting, and over TCP
+// if the reply is truncated.
+func (p *Provider) lookupSOA(ctx context.Context, name string) (*dns.SOA, error) {
+	conf, err := systemResolverConfig()
+	if err != nil {
+		return nil, err
+	} else if len(conf.Servers) == 0 {
+		return nil, errors.New("no name server found in resolver configuration")
+	}
+
+	for {
+		soa, err := p.querySOA(ctx, conf, name)
+		if soa != nil || err != nil {
+			return soa, err
+		}
+		if name == "." {
+			return nil, fmt.Errorf("no SOA record found for %v", name)
+		}
+		if off, end := dns.NextLabel(name, 0); end {
+			name = "."
+		} else {
+			name = name[off:]
+		}
+	}
+}
+
+// querySOA queries the name servers of the system resolver configuration for
+// the SOA record of a name, returning the SOA record found in the answer or
+// the authority section, if any.
+func (p *Provider) querySOA(ctx context.Context, conf *dns.ClientConfig, name string) (*dns.SOA, error) {
+	var query dns.Msg
+	query.SetQuestion(name, dns.TypeSOA)
+
+	var err error
+	for _, server := range conf.Servers {
+		addr := net.JoinHostPort(server, conf.Port)
+		var reply *dns.Msg
+		reply, err = p.exchangeConn(ctx, "udp", addr, &query, nil)
+		if err == nil && reply.Truncated {
+			reply, err = p.exchangeConn(ctx, "tcp", addr, &query, nil)
+		}
+		if err != nil {
+			continue
+		} else if reply.Rcode != dns.RcodeSuccess && reply.Rcode != dns.RcodeNameError {
+			err = RcodeError(reply.Rcode)
+			continue
+		}
+
+		for _, rr := range append(reply.Answer, reply.Ns...) {
+			if soa, ok := rr.(*dns.SOA); ok {
+				return soa, nil
+			}
+		}
+		return nil, nil
+	}
+	return nil, err
+}
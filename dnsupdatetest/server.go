@@ -0,0 +1,267 @@
+// Package dnsupdatetest provides an in-memory authoritative DNS server for
+// integration tests, supporting zone transfers and DNS UPDATE.
+//
+//	srv := dnsupdatetest.NewServer("example.org.")
+//	defer srv.Close()
+//
+//	provider := srv.Provider()
+//	records, err := provider.GetRecords(ctx, "example.org.")
+package dnsupdatetest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/dnsupdate"
+	"github.com/miekg/dns"
+)
+
+// Server is an authoritative DNS server listening on a local port over UDP
+// and TCP. It answers queries and zone transfers, and applies updates as
+// specified by RFC 2136, including prerequisites.
+type Server struct {
+	// Address of the server, such as "127.0.0.1:12345".
+	Addr string
+
+	keyName string
+	secret  string
+
+	mu    sync.Mutex
+	zones map[string][]dns.RR
+
+	servers []*dns.Server
+}
+
+// NewServer starts a server authoritative for the given zones, which only
+// contain a SOA and a NS record at first. It panics if the server can't
+// listen on a local port.
+func NewServer(zones ...string) *Server {
+	return NewServerTSIG("", "", zones...)
+}
+
+// NewServerTSIG starts a server which only accepts messages signed with a
+// TSIG key, with a base64-encoded secret, using HMAC-SHA256.
+func NewServerTSIG(keyName, secret string, zones ...string) *Server {
+	s := &Server{secret: secret, zones: make(map[string][]dns.RR)}
+	if keyName != "" {
+		s.keyName = dns.CanonicalName(keyName)
+	}
+	for _, zone := range zones {
+		zone = dns.CanonicalName(zone)
+		s.zones[zone] = []dns.RR{
+			&dns.SOA{
+				Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+				Ns:      "ns." + zone,
+				Mbox:    "hostmaster." + zone,
+				Serial:  1,
+				Refresh: 3600,
+				Retry:   600,
+				Expire:  86400,
+				Minttl:  300,
+			},
+			&dns.NS{
+				Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 3600},
+				Ns:  "ns." + zone,
+			},
+		}
+	}
+
+	if err := s.listen(); err != nil {
+		panic(fmt.Sprintf("dnsupdatetest: failed to listen: %v", err))
+	}
+	return s
+}
+
+// listen starts the UDP and TCP servers on the same random port.
+func (s *Server) listen() error {
+	var err error
+	for range 10 {
+		var l net.Listener
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		var pc net.PacketConn
+		pc, err = net.ListenPacket("udp", l.Addr().String())
+		if err != nil {
+			// The port is already in use for UDP, try another one
+			l.Close()
+			continue
+		}
+
+		s.Addr = l.Addr().String()
+		s.servers = []*dns.Server{
+			{Listener: l, Handler: s},
+			{PacketConn: pc, Handler: s},
+		}
+		break
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, srv := range s.servers {
+		if s.keyName != "" {
+			srv.TsigSecret = map[string]string{s.keyName: s.secret}
+		}
+		// The default function rejects updates
+		srv.MsgAcceptFunc = func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept }
+		started := make(chan struct{})
+		srv.NotifyStartedFunc = func() { close(started) }
+		go srv.ActivateAndServe()
+		<-started
+	}
+	return nil
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	for _, srv := range s.servers {
+		srv.Shutdown()
+	}
+}
+
+// Provider returns a provider sending messages to the server, signed with
+// its TSIG key if any.
+func (s *Server) Provider() *dnsupdate.Provider {
+	return &dnsupdate.Provider{
+		Addr:          s.Addr,
+		TSIGKeyName:   s.keyName,
+		TSIGAlgorithm: "hmac-sha256",
+		TSIGSecret:    s.secret,
+	}
+}
+
+// Records returns a copy of the records of a zone, starting with its SOA
+// record.
+func (s *Server) Records(zone string) []dns.RR {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rrs []dns.RR
+	for _, rr := range s.zones[dns.CanonicalName(zone)] {
+		rrs = append(rrs, dns.Copy(rr))
+	}
+	return rrs
+}
+
+// ServeDNS implements dns.Handler.
+func (s *Server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	var reply dns.Msg
+	reply.SetReply(req)
+	reply.Authoritative = true
+
+	tsig := req.IsTsig()
+	switch {
+	case s.keyName != "" && tsig == nil:
+		reply.Rcode = dns.RcodeRefused
+	case tsig != nil && w.TsigStatus() != nil:
+		// Reply with an error, only signed for BADTIME as specified by
+		// RFC 8945
+		reply.Rcode = dns.RcodeNotAuth
+		reply.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, int64(tsig.TimeSigned))
+		t := reply.Extra[0].(*dns.TSIG)
+		switch {
+		case errors.Is(w.TsigStatus(), dns.ErrSecret):
+			t.Error = dns.RcodeBadKey
+		case errors.Is(w.TsigStatus(), dns.ErrTime):
+			// The reply carries the time of the server
+			t.Error = dns.RcodeBadTime
+			t.OtherLen = 6
+			t.OtherData = fmt.Sprintf("%012x", time.Now().Unix())
+		default:
+			t.Error = dns.RcodeBadSig
+		}
+		w.WriteMsg(&reply)
+		return
+	case len(req.Question) != 1:
+		reply.Rcode = dns.RcodeFormatError
+	case req.Opcode == dns.OpcodeUpdate:
+		reply.Rcode = s.update(req)
+	case req.Opcode != dns.OpcodeQuery:
+		reply.Rcode = dns.RcodeNotImplemented
+	case req.Question[0].Qtype == dns.TypeAXFR || req.Question[0].Qtype == dns.TypeIXFR:
+		// IXFR requests are answered with a full transfer
+		if rrs := s.Records(req.Question[0].Name); rrs != nil {
+			s.transfer(w, req, rrs)
+			return
+		}
+		reply.Rcode = dns.RcodeNotAuth
+	default:
+		s.query(req.Question[0], &reply)
+	}
+
+	if tsig != nil {
+		reply.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, int64(tsig.TimeSigned))
+	}
+	w.WriteMsg(&reply)
+}
+
+// transfer sends all the records of a zone, in envelopes of a few hundred
+// records, followed by the SOA record again.
+func (s *Server) transfer(w dns.ResponseWriter, req *dns.Msg, rrs []dns.RR) {
+	ch := make(chan *dns.Envelope)
+	go func() {
+		defer close(ch)
+		rrs = append(rrs, rrs[0])
+		for chunk := range slices.Chunk(rrs, 500) {
+			ch <- &dns.Envelope{RR: chunk}
+		}
+	}()
+
+	var tr dns.Transfer
+	if err := tr.Out(w, req, ch); err != nil {
+		for range ch {
+		}
+	}
+	w.Close()
+}
+
+// query answers an ordinary query.
+func (s *Server) query(q dns.Question, reply *dns.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zone, rrs := s.findZone(q.Name)
+	if zone == "" {
+		reply.Rcode = dns.RcodeRefused
+		return
+	}
+
+	found := false
+	for _, rr := range rrs {
+		if !strings.EqualFold(rr.Header().Name, q.Name) {
+			continue
+		}
+		found = true
+		if q.Qtype == dns.TypeANY || rr.Header().Rrtype == q.Qtype {
+			reply.Answer = append(reply.Answer, dns.Copy(rr))
+		}
+	}
+	if len(reply.Answer) == 0 {
+		if !found {
+			reply.Rcode = dns.RcodeNameError
+		}
+		reply.Ns = []dns.RR{dns.Copy(rrs[0])}
+	}
+}
+
+// findZone returns the closest zone containing a name, and its records.
+func (s *Server) findZone(name string) (string, []dns.RR) {
+	name = dns.CanonicalName(name)
+	for {
+		if rrs, ok := s.zones[name]; ok {
+			return name, rrs
+		}
+		i, end := dns.NextLabel(name, 0)
+		if end {
+			return "", nil
+		}
+		name = name[i:]
+	}
+}
@@ -0,0 +1,198 @@
+package dnsupdatetest
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// update applies an update message, and returns the response code.
+func (s *Server) update(req *dns.Msg) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := req.Question[0]
+	zone := dns.CanonicalName(q.Name)
+	rrs, ok := s.zones[zone]
+	if q.Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	} else if !ok {
+		return dns.RcodeNotAuth
+	}
+
+	if rcode := checkPrerequisites(zone, rrs, req.Answer); rcode != dns.RcodeSuccess {
+		return rcode
+	}
+	for _, rr := range req.Ns {
+		if rcode := checkUpdate(zone, rr); rcode != dns.RcodeSuccess {
+			return rcode
+		}
+	}
+
+	updated := slices.Clone(rrs)
+	for _, rr := range req.Ns {
+		updated = applyUpdate(zone, updated, rr)
+	}
+
+	changed := len(updated) != len(rrs)
+	for i := range updated {
+		if changed {
+			break
+		}
+		changed = updated[i] != rrs[i]
+	}
+	if changed {
+		// The serial is incremented unless the update sets it
+		if updated[0] == rrs[0] {
+			soa := dns.Copy(updated[0]).(*dns.SOA)
+			soa.Serial++
+			updated[0] = soa
+		}
+		s.zones[zone] = updated
+	}
+	return dns.RcodeSuccess
+}
+
+// checkPrerequisites checks the prerequisites of an update, as specified by
+// RFC 2136 section 3.2.
+func checkPrerequisites(zone string, rrs, prereqs []dns.RR) int {
+	var values []dns.RR
+	for _, rr := range prereqs {
+		hdr := rr.Header()
+		if !dns.IsSubDomain(zone, hdr.Name) {
+			return dns.RcodeNotZone
+		}
+
+		switch hdr.Class {
+		case dns.ClassANY:
+			if hdr.Ttl != 0 {
+				return dns.RcodeFormatError
+			} else if hdr.Rrtype == dns.TypeANY && !nameExists(rrs, hdr.Name) {
+				return dns.RcodeNameError
+			} else if hdr.Rrtype != dns.TypeANY && len(rrset(rrs, hdr.Name, hdr.Rrtype)) == 0 {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 {
+				return dns.RcodeFormatError
+			} else if hdr.Rrtype == dns.TypeANY && nameExists(rrs, hdr.Name) {
+				return dns.RcodeYXDomain
+			} else if hdr.Rrtype != dns.TypeANY && len(rrset(rrs, hdr.Name, hdr.Rrtype)) > 0 {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			if hdr.Ttl != 0 {
+				return dns.RcodeFormatError
+			}
+			values = append(values, rr)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	// RRsets given with values must match exactly
+	for _, rr := range values {
+		hdr := rr.Header()
+		want := rrset(values, hdr.Name, hdr.Rrtype)
+		got := rrset(rrs, hdr.Name, hdr.Rrtype)
+		if len(got) != len(want) || !slices.ContainsFunc(got, func(g dns.RR) bool { return dns.IsDuplicate(g, rr) }) {
+			return dns.RcodeNXRrset
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// checkUpdate checks a change of an update, as specified by RFC 2136
+// section 3.4.1.
+func checkUpdate(zone string, rr dns.RR) int {
+	hdr := rr.Header()
+	if !dns.IsSubDomain(zone, hdr.Name) {
+		return dns.RcodeNotZone
+	}
+
+	meta := hdr.Rrtype == dns.TypeANY || hdr.Rrtype == dns.TypeAXFR || hdr.Rrtype == dns.TypeIXFR
+	switch hdr.Class {
+	case dns.ClassINET:
+		if meta {
+			return dns.RcodeFormatError
+		}
+	case dns.ClassANY:
+		if hdr.Ttl != 0 || hdr.Rdlength != 0 || (meta && hdr.Rrtype != dns.TypeANY) {
+			return dns.RcodeFormatError
+		}
+	case dns.ClassNONE:
+		if hdr.Ttl != 0 || meta {
+			return dns.RcodeFormatError
+		}
+	default:
+		return dns.RcodeFormatError
+	}
+	return dns.RcodeSuccess
+}
+
+// applyUpdate applies a change to the records of a zone, as specified by RFC
+// 2136 section 3.4.2. The SOA record and the NS records of the zone apex
+// are never deleted.
+func applyUpdate(zone string, rrs []dns.RR, rr dns.RR) []dns.RR {
+	hdr := rr.Header()
+	apex := strings.EqualFold(hdr.Name, zone)
+	switch hdr.Class {
+	case dns.ClassINET:
+		if hdr.Rrtype == dns.TypeSOA {
+			// The SOA record is replaced if its serial increases
+			if apex && serialGreater(rr.(*dns.SOA).Serial, rrs[0].(*dns.SOA).Serial) {
+				rrs[0] = dns.Copy(rr)
+			}
+			return rrs
+		}
+		// Adding an existing record only updates its TTL
+		if i := slices.IndexFunc(rrs, func(r dns.RR) bool { return dns.IsDuplicate(r, rr) }); i >= 0 {
+			if rrs[i].Header().Ttl != hdr.Ttl {
+				rrs[i] = dns.Copy(rr)
+			}
+			return rrs
+		}
+		return append(rrs, dns.Copy(rr))
+	case dns.ClassANY:
+		return slices.DeleteFunc(rrs, func(r dns.RR) bool {
+			h := r.Header()
+			if !strings.EqualFold(h.Name, hdr.Name) || (hdr.Rrtype != dns.TypeANY && h.Rrtype != hdr.Rrtype) {
+				return false
+			}
+			return !apex || (h.Rrtype != dns.TypeSOA && h.Rrtype != dns.TypeNS)
+		})
+	case dns.ClassNONE:
+		if hdr.Rrtype == dns.TypeSOA || (apex && hdr.Rrtype == dns.TypeNS && len(rrset(rrs, zone, dns.TypeNS)) <= 1) {
+			return rrs
+		}
+		match := dns.Copy(rr)
+		match.Header().Class = dns.ClassINET
+		return slices.DeleteFunc(rrs, func(r dns.RR) bool { return dns.IsDuplicate(r, match) })
+	}
+	return rrs
+}
+
+// nameExists returns true if a name owns any record.
+func nameExists(rrs []dns.RR, name string) bool {
+	return slices.ContainsFunc(rrs, func(rr dns.RR) bool {
+		return strings.EqualFold(rr.Header().Name, name)
+	})
+}
+
+// rrset returns the records of a RRset.
+func rrset(rrs []dns.RR, name string, rrtype uint16) []dns.RR {
+	var set []dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == rrtype && strings.EqualFold(rr.Header().Name, name) {
+			set = append(set, rr)
+		}
+	}
+	return set
+}
+
+// serialGreater compares SOA serials using sequence space arithmetic
+// (RFC 1982).
+func serialGreater(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
@@ -0,0 +1,49 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+
+	"github.com/miekg/dns"
+)
+
+// Do sends a hand-built message, such as an update with custom
+// prerequisites or a message with an unusual opcode, and returns the reply.
+// The message goes through the same machinery as the other methods: it's
+// sent to the configured servers with their transports, signed with the key
+// of the zone in its question section, and retried on transient errors.
+// Replies with an error response code are returned as RcodeError.
+//
+// The message is sent as is, even in dry-run mode, but updates must still
+// only change names allowed by Scope, not change ProtectedRecords, not
+// delete more records than MaxDeletes, and be confirmed by ConfirmFunc.
+// They are serialized with the other updates of the zone.
+func (p *Provider) Do(ctx context.Context, msg *dns.Msg) (_ *dns.Msg, err error) {
+	if len(msg.Question) == 0 {
+		return nil, errors.New("message without question")
+	}
+	zone := msg.Question[0].Name
+
+	ctx, span := p.startSpan(ctx, "Do", zone)
+	defer func() { endSpan(span, err) }()
+
+	if msg.Opcode == dns.OpcodeUpdate {
+		unlock, err := p.lockZone(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+
+		if err := p.checkChanges(ctx, msg); err != nil {
+			return nil, err
+		}
+		if err := p.checkMaxDeletes(ctx, msg); err != nil {
+			return nil, err
+		}
+		if err := p.confirmUpdate(ctx, msg); err != nil {
+			return nil, err
+		}
+		defer p.invalidateCache(zone)
+	}
+	return p.roundTrip(ctx, msg)
+}
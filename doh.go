@@ -0,0 +1,82 @@
+package dnsupdate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// dohMediaType is the media type for DNS messages carried over HTTPS, as
+// defined in RFC 8484.
+const dohMediaType = "application/dns-message"
+
+func isHTTPSAddr(addr string) bool {
+	return strings.HasPrefix(addr, "https://")
+}
+
+func (p *Provider) httpClient() (*http.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Keep a single client around so that HTTP/2 connections are reused
+	// across calls
+	if p.http == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.ForceAttemptHTTP2 = true
+		transport.DialContext = p.dial
+		transport.ResponseHeaderTimeout = p.readTimeout()
+		if p.customTLS() {
+			tlsConfig, err := p.tlsConfig("")
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = tlsConfig
+		}
+		p.http = &http.Client{Transport: transport}
+	}
+	return p.http, nil
+}
+
+// exchangeHTTPS sends a query to a DNS-over-HTTPS server.
+func (p *Provider) exchangeHTTPS(ctx context.Context, addr string, query *dns.Msg, s signer) (*dns.Msg, error) {
+	buf, sig, err := packMsg(query, s)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohMediaType)
+	req.Header.Set("Accept", dohMediaType)
+
+	client, err := p.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP error: %v", resp.Status)
+	}
+	if mediaType := resp.Header.Get("Content-Type"); mediaType != dohMediaType {
+		return nil, fmt.Errorf("unexpected HTTP response content type %q", mediaType)
+	}
+
+	buf, err = io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return unpackReply(buf, s, sig)
+}
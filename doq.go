@@ -0,0 +1,120 @@
+package dnsupdate
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// doqALPN is the ALPN token for DNS-over-QUIC, as defined in RFC 9250.
+const doqALPN = "doq"
+
+// QUICTransport sends DNS messages over QUIC, for DNS-over-QUIC servers. It's
+// implemented by the github.com/libdns/dnsupdate/doq module, which is kept
+// separate since quic-go requires a more recent Go version than this package.
+type QUICTransport interface {
+	// Exchange sends a query, already packed and signed, to the server at
+	// addr, a host:port pair, on a new stream. It passes the messages of the
+	// reply to handle until it returns false or the server closes the
+	// stream: the reply to a zone transfer may span several messages.
+	Exchange(ctx context.Context, conf *QUICConfig, addr string, query []byte, handle func(msg []byte) bool) error
+}
+
+// QUICConfig holds the settings of a provider that a QUICTransport connects
+// to servers with.
+type QUICConfig struct {
+	// TLS configuration for the server, including the DNS-over-QUIC ALPN
+	// token, the certificate checks and the client certificate.
+	TLS *tls.Config
+
+	// Dial connects a datagram socket to the server, from LocalAddr or with
+	// DialContext, and to the IP address given by its DNS stamp, if any.
+	Dial func(ctx context.Context, addr string) (net.Conn, error)
+
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+func isQUICAddr(addr string) bool {
+	return strings.HasPrefix(addr, "quic://")
+}
+
+// exchangeQUIC sends a query to a DNS-over-QUIC server.
+func (p *Provider) exchangeQUIC(ctx context.Context, addr string, query *dns.Msg, s signer) (*dns.Msg, error) {
+	if p.QUICTransport == nil {
+		return nil, errors.New("DNS-over-QUIC requires setting QUICTransport, see the github.com/libdns/dnsupdate/doq module")
+	}
+
+	addr = strings.TrimPrefix(addr, "quic://")
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := p.tlsConfig(host, doqALPN)
+	if err != nil {
+		return nil, err
+	}
+	conf := &QUICConfig{
+		TLS: tlsConfig,
+		Dial: func(ctx context.Context, addr string) (net.Conn, error) {
+			return p.dial(ctx, "udp", addr)
+		},
+		DialTimeout:  p.dialTimeout(),
+		ReadTimeout:  p.readTimeout(),
+		WriteTimeout: p.writeTimeout(),
+	}
+
+	// The message ID must be set to zero, see RFC 9250 section 4.2.1
+	query = query.Copy()
+	query.Id = 0
+
+	buf, sig, err := packMsg(query, s)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		reply     *dns.Msg
+		handleErr error
+	)
+	err = p.QUICTransport.Exchange(ctx, conf, addr, buf, func(buf []byte) bool {
+		if reply == nil {
+			reply, handleErr = unpackReply(buf, s, sig)
+			if handleErr != nil || !isTransfer(query) || reply.Rcode != dns.RcodeSuccess {
+				return false
+			}
+			if t := reply.IsTsig(); t != nil {
+				sig = t.MAC
+			}
+			return true
+		}
+
+		msg, err := unpackTransferMsg(buf, s, &sig)
+		if err != nil {
+			handleErr = err
+			return false
+		}
+		if msg.Rcode != dns.RcodeSuccess {
+			reply.Rcode = msg.Rcode
+			return false
+		}
+		reply.Answer = append(reply.Answer, msg.Answer...)
+		return true
+	})
+	switch {
+	case handleErr != nil:
+		return nil, handleErr
+	case err != nil:
+		return nil, err
+	case reply == nil:
+		return nil, fmt.Errorf("malformed DNS-over-QUIC response")
+	}
+	return reply, nil
+}
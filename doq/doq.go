@@ -0,0 +1,189 @@
+// Package doq implements DNS-over-QUIC, as defined in RFC 9250, for the DNS
+// UPDATE provider:
+//
+//	provider := &dnsupdate.Provider{
+//		Addr:          "quic://ns1.example.org",
+//		QUICTransport: new(doq.Transport),
+//	}
+//
+// It is a separate Go module, since quic-go requires a more recent Go
+// version than the main package.
+package doq
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/libdns/dnsupdate"
+	"github.com/quic-go/quic-go"
+)
+
+// DNS-over-QUIC error codes, see RFC 9250 section 4.3.
+const (
+	doqNoError          = 0x0
+	doqRequestCancelled = 0x3
+)
+
+// Transport sends DNS messages to DNS-over-QUIC servers. The connection to
+// each server is established once and re-used across queries. The zero
+// value is ready to use, and a Transport must not be copied after first use.
+type Transport struct {
+	mu    sync.Mutex
+	conns map[string]*quic.Conn
+}
+
+// Exchange implements dnsupdate.QUICTransport.
+func (t *Transport) Exchange(ctx context.Context, conf *dnsupdate.QUICConfig, addr string, query []byte, handle func(msg []byte) bool) error {
+	conn, err := t.conn(ctx, conf, addr)
+	if err != nil {
+		return err
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		stream.CancelRead(doqRequestCancelled)
+		stream.CancelWrite(doqRequestCancelled)
+	})
+	defer stop()
+
+	stream.SetWriteDeadline(time.Now().Add(conf.WriteTimeout))
+
+	// Each query is sent on its own stream, prefixed with a two-octet length
+	// field, and the stream is closed for writing after the query
+	req := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(req, uint16(len(query)))
+	copy(req[2:], query)
+	if _, err := stream.Write(req); err != nil {
+		return err
+	}
+	if err := stream.Close(); err != nil {
+		return err
+	}
+
+	// The reply to a zone transfer may span several messages, each prefixed
+	// with its length, until the server closes the stream
+	for first := true; ; first = false {
+		stream.SetReadDeadline(time.Now().Add(conf.ReadTimeout))
+		buf, err := readMsg(stream)
+		if errors.Is(err, io.EOF) && !first {
+			return nil
+		} else if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("malformed DNS-over-QUIC response")
+		} else if err != nil {
+			return err
+		}
+
+		if !handle(buf) {
+			stream.CancelRead(doqNoError)
+			return nil
+		}
+	}
+}
+
+// conn returns the connection to a server, established once and re-used
+// across queries.
+func (t *Transport) conn(ctx context.Context, conf *dnsupdate.QUICConfig, addr string) (*quic.Conn, error) {
+	// Re-use the existing connection unless it has been closed
+	if conn := t.openConn(addr); conn != nil {
+		return conn, nil
+	}
+
+	// The handshake is done without holding the lock, so that it doesn't
+	// block queries to other servers
+	conn, err := dial(ctx, conf, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the connection established concurrently by another query, if any
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if other, ok := t.conns[addr]; ok && other.Context().Err() == nil {
+		conn.CloseWithError(doqNoError, "")
+		return other, nil
+	}
+	if t.conns == nil {
+		t.conns = make(map[string]*quic.Conn)
+	}
+	t.conns[addr] = conn
+	return conn, nil
+}
+
+// openConn returns the connection to a server if it's still open, and
+// forgets it otherwise.
+func (t *Transport) openConn(addr string) *quic.Conn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conn, ok := t.conns[addr]
+	if !ok {
+		return nil
+	}
+	select {
+	case <-conn.Context().Done():
+		delete(t.conns, addr)
+		return nil
+	default:
+		return conn
+	}
+}
+
+func dial(ctx context.Context, conf *dnsupdate.QUICConfig, addr string) (*quic.Conn, error) {
+	udpConn, err := conf.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	quicConfig := &quic.Config{HandshakeIdleTimeout: conf.DialTimeout}
+	conn, err := quic.Dial(ctx, packetConn{udpConn}, udpConn.RemoteAddr(), conf.TLS, quicConfig)
+	if err != nil {
+		udpConn.Close()
+		return nil, err
+	}
+	context.AfterFunc(conn.Context(), func() {
+		udpConn.Close()
+	})
+	return conn, nil
+}
+
+// packetConn adapts a connected datagram connection to the net.PacketConn
+// interface expected by quic-go.
+type packetConn struct {
+	net.Conn
+}
+
+func (c packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Read(b)
+	return n, c.RemoteAddr(), err
+}
+
+func (c packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.Write(b)
+}
+
+// readMsg reads a message prefixed with its length from a stream. It returns
+// io.EOF if the stream ends before the message.
+func readMsg(stream io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(stream, length[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(stream, buf); errors.Is(err, io.EOF) {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Interface guard
+var _ dnsupdate.QUICTransport = (*Transport)(nil)
@@ -0,0 +1,129 @@
+package doq_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/libdns/dnsupdate/dnsupdatetest"
+	"github.com/libdns/dnsupdate/doq"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+const testZone = "example.org."
+
+func TestTransport(t *testing.T) {
+	srv := dnsupdatetest.NewServer(testZone)
+	t.Cleanup(srv.Close)
+
+	// Borrow the test certificate of httptest
+	https := httptest.NewTLSServer(nil)
+	https.Close()
+	config := https.TLS.Clone()
+	config.NextProtos = []string{"doq"}
+	ln, err := quic.ListenAddr("127.0.0.1:0", config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go serveDoQ(ln, srv)
+
+	p := srv.Provider()
+	p.Addr = "quic://" + ln.Addr().String()
+	p.TLSInsecureSkipVerify = true
+	p.QUICTransport = new(doq.Transport)
+	ctx := context.Background()
+
+	// The zone transfer spans several messages
+	var recs []libdns.Record
+	for i := range 700 {
+		recs = append(recs, libdns.TXT{Name: fmt.Sprintf("h%d", i), Text: "x"})
+	}
+	if _, err := p.AppendRecords(ctx, testZone, recs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.GetRecords(ctx, testZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(recs)+2 {
+		t.Errorf("GetRecords returned %d records, want %d", len(got), len(recs)+2)
+	}
+}
+
+// serveDoQ serves DNS messages received over QUIC connections, one per
+// stream, as described in RFC 9250.
+func serveDoQ(ln *quic.Listener, handler dns.Handler) {
+	for {
+		conn, err := ln.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			for {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				go serveStream(conn, stream, handler)
+			}
+		}()
+	}
+}
+
+func serveStream(conn *quic.Conn, stream *quic.Stream, handler dns.Handler) {
+	defer stream.Close()
+
+	var length [2]byte
+	if _, err := io.ReadFull(stream, length[:]); err != nil {
+		return
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		return
+	}
+	var req dns.Msg
+	if err := req.Unpack(buf); err != nil {
+		return
+	}
+	handler.ServeDNS(&streamWriter{conn: conn, stream: stream}, &req)
+}
+
+// streamWriter writes the replies of a handler to a stream, each prefixed
+// with its length.
+type streamWriter struct {
+	conn   *quic.Conn
+	stream *quic.Stream
+}
+
+func (w *streamWriter) WriteMsg(msg *dns.Msg) error {
+	buf, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+func (w *streamWriter) Write(buf []byte) (int, error) {
+	msg := make([]byte, 2+len(buf))
+	binary.BigEndian.PutUint16(msg, uint16(len(buf)))
+	copy(msg[2:], buf)
+	if _, err := w.stream.Write(msg); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+func (w *streamWriter) LocalAddr() net.Addr  { return w.conn.LocalAddr() }
+func (w *streamWriter) RemoteAddr() net.Addr { return w.conn.RemoteAddr() }
+func (w *streamWriter) Close() error         { return w.stream.Close() }
+func (w *streamWriter) TsigStatus() error    { return nil }
+func (w *streamWriter) TsigTimersOnly(bool)  {}
+func (w *streamWriter) Hijack()              {}
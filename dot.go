@@ -0,0 +1,38 @@
+package dnsupdate
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+)
+
+// dotALPN is the ALPN token for DNS-over-TLS, as registered by RFC 7858.
+const dotALPN = "dot"
+
+func isTLSAddr(addr string) bool {
+	return strings.HasPrefix(addr, "tls://")
+}
+
+// dialTLS connects to a DNS-over-TLS server.
+func (p *Provider) dialTLS(ctx context.Context, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := p.tlsConfig(host, dotALPN)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
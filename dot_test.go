@@ -0,0 +1,51 @@
+package dnsupdate_test
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/libdns/dnsupdate/dnsupdatetest"
+	"github.com/miekg/dns"
+)
+
+func TestDoT(t *testing.T) {
+	srv := dnsupdatetest.NewServer(testZone)
+	t.Cleanup(srv.Close)
+
+	// Borrow the test certificate of httptest
+	https := httptest.NewTLSServer(nil)
+	https.Close()
+	config := https.TLS.Clone()
+	config.NextProtos = []string{"dot"}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot := &dns.Server{
+		Listener:      ln,
+		Net:           "tcp-tls",
+		Handler:       srv,
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go dot.ActivateAndServe()
+	t.Cleanup(func() { dot.Shutdown() })
+
+	p := srv.Provider()
+	p.Addr = "tls://" + ln.Addr().String()
+	p.TLSInsecureSkipVerify = true
+	ctx := context.Background()
+
+	recs := txtRecords(700)
+	if _, err := p.AppendRecords(ctx, testZone, recs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.GetRecords(ctx, testZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(recs)+2 {
+		t.Errorf("GetRecords returned %d records, want %d", len(got), len(recs)+2)
+	}
+}
@@ -0,0 +1,48 @@
+package dnsupdate
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/miekg/dns"
+)
+
+// sendUpdate sends an update message, or only reports it in dry-run mode.
+// It returns errQueued if the update was queued with QueueUpdates. The
+// changes must have been checked with checkChanges.
+func (p *Provider) sendUpdate(ctx context.Context, query *dns.Msg) error {
+	if !p.DryRun {
+		if p.QueueUpdates {
+			return p.sendOrQueueUpdate(ctx, query)
+		}
+		return p.deliverUpdate(ctx, query)
+	}
+
+	if p.CheckZone {
+		if err := p.checkZoneHosted(ctx, query.Question[0].Name); err != nil {
+			return err
+		}
+	}
+	if p.DryRunFunc != nil {
+		p.DryRunFunc(query)
+	} else {
+		fmt.Fprintln(os.Stderr, query)
+	}
+	return nil
+}
+
+// deliverUpdate sends an update message to the servers.
+func (p *Provider) deliverUpdate(ctx context.Context, query *dns.Msg) error {
+	if p.CheckZone {
+		if err := p.checkZoneHosted(ctx, query.Question[0].Name); err != nil {
+			return err
+		}
+	}
+
+	if p.VerifySerial {
+		return p.sendVerifiedUpdate(ctx, query)
+	}
+	_, err := p.roundTrip(ctx, query)
+	return err
+}
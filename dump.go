@@ -0,0 +1,34 @@
+package dnsupdate
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// dumpMsg writes a message sent to or received from a server to DumpWriter,
+// if set.
+func (p *Provider) dumpMsg(direction, addr string, msg *dns.Msg) {
+	if p.DumpWriter == nil || msg == nil {
+		return
+	}
+
+	// Write the whole message at once, so that concurrent dumps aren't
+	// interleaved
+	var b bytes.Buffer
+	fmt.Fprintf(&b, ";; %v %v\n", direction, addr)
+	if p.DumpHex {
+		wire, err := msg.Pack()
+		if err != nil {
+			fmt.Fprintf(&b, ";; failed to pack message: %v\n", err)
+		} else {
+			b.WriteString(hex.Dump(wire))
+		}
+	} else {
+		b.WriteString(msg.String())
+	}
+	b.WriteString("\n")
+	p.DumpWriter.Write(b.Bytes())
+}
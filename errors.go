@@ -0,0 +1,113 @@
+package dnsupdate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RcodeError is returned when a server replies with an error response code,
+// or reports a TSIG or TKEY error. It can be compared to the errors below
+// with errors.Is.
+type RcodeError int
+
+// Errors returned for the most common response codes.
+const (
+	ErrFormErr  = RcodeError(dns.RcodeFormatError)
+	ErrServFail = RcodeError(dns.RcodeServerFailure)
+	ErrNXDomain = RcodeError(dns.RcodeNameError)
+	ErrNotImp   = RcodeError(dns.RcodeNotImplemented)
+	ErrRefused  = RcodeError(dns.RcodeRefused)
+	ErrYXDomain = RcodeError(dns.RcodeYXDomain)
+	ErrYXRRSet  = RcodeError(dns.RcodeYXRrset)
+	ErrNXRRSet  = RcodeError(dns.RcodeNXRrset)
+	ErrNotAuth  = RcodeError(dns.RcodeNotAuth)
+	ErrNotZone  = RcodeError(dns.RcodeNotZone)
+	ErrBadSig   = RcodeError(dns.RcodeBadSig)
+	ErrBadKey   = RcodeError(dns.RcodeBadKey)
+	ErrBadTime  = RcodeError(dns.RcodeBadTime)
+)
+
+func (err RcodeError) Error() string {
+	if s, ok := dns.RcodeToString[int(err)]; ok {
+		return fmt.Sprintf("DNS error: %v", s)
+	}
+	return fmt.Sprintf("DNS error: RCODE%d", int(err))
+}
+
+// ErrZoneNotHosted is returned when CheckZone is set and the server isn't
+// authoritative for the zone of an update.
+var ErrZoneNotHosted = errors.New("zone not hosted by the server")
+
+// ExchangeError is returned when a server fails to handle a message, with
+// the details of the exchange. It wraps the cause of the failure, such as a
+// RcodeError or a network error.
+type ExchangeError struct {
+	// Address of the server.
+	Server string
+
+	// Message sent to the server, before signing.
+	Query *dns.Msg
+
+	// Reply of the server, if any, including its TSIG record reporting
+	// signature errors.
+	Reply *dns.Msg
+
+	// Time spent on the exchange.
+	Duration time.Duration
+
+	Err error
+}
+
+func (err *ExchangeError) Error() string {
+	msg := fmt.Sprintf("server %v: %v", err.Server, err.Err)
+	for _, ede := range err.ExtendedErrors() {
+		msg += fmt.Sprintf(" (%v)", formatEDE(ede))
+	}
+	return msg
+}
+
+// ExtendedErrors returns the Extended DNS Errors (RFC 8914) of the reply,
+// which servers such as BIND and Knot add to explain failures, for instance
+// when their update policy doesn't allow a key to change a name.
+func (err *ExchangeError) ExtendedErrors() []*dns.EDNS0_EDE {
+	if err.Reply == nil {
+		return nil
+	}
+	return extendedErrors(err.Reply)
+}
+
+// extendedErrors returns the Extended DNS Errors of a message.
+func extendedErrors(msg *dns.Msg) []*dns.EDNS0_EDE {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	var edes []*dns.EDNS0_EDE
+	for _, option := range opt.Option {
+		if ede, ok := option.(*dns.EDNS0_EDE); ok {
+			edes = append(edes, ede)
+		}
+	}
+	return edes
+}
+
+// formatEDE formats an Extended DNS Error, such as "EDE 18: Prohibited: key
+// not permitted".
+func formatEDE(ede *dns.EDNS0_EDE) string {
+	s := fmt.Sprintf("EDE %d", ede.InfoCode)
+	if name, ok := dns.ExtendedErrorCodeToString[ede.InfoCode]; ok {
+		s += ": " + name
+	}
+	if ede.ExtraText != "" {
+		s += ": " + ede.ExtraText
+	}
+	return s
+}
+
+func (err *ExchangeError) Unwrap() error {
+	return err.Err
+}
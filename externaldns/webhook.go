@@ -0,0 +1,312 @@
+// Package externaldns implements the webhook provider API of Kubernetes
+// external-dns with DNS UPDATE, so that clusters can manage records on
+// servers such as BIND and Knot through the standard webhook path.
+//
+//	provider := &dnsupdate.Provider{Addr: "ns1.example.org", ...}
+//	handler := externaldns.NewHandler(provider, "example.org.")
+//	log.Fatal(http.ListenAndServe("localhost:8888", handler))
+//
+// Records are listed with zone transfers, and the changes to each zone are
+// sent in a single update message, so that they are applied atomically.
+// Changes spanning several zones are only atomic per zone: all the updates
+// are validated before any is sent, but an update failing on the server
+// leaves the zones updated before it changed.
+package externaldns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/libdns/dnsupdate"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// mediaType is the media type of the requests and replies of the webhook
+// API.
+const mediaType = "application/external.dns.webhook+json;version=1"
+
+// Endpoint is a set of records of a name and type, as exchanged with
+// external-dns.
+type Endpoint struct {
+	DNSName       string   `json:"dnsName"`
+	Targets       []string `json:"targets"`
+	RecordType    string   `json:"recordType"`
+	SetIdentifier string   `json:"setIdentifier,omitempty"`
+	RecordTTL     int64    `json:"recordTTL,omitempty"`
+
+	Labels           map[string]string          `json:"labels,omitempty"`
+	ProviderSpecific []ProviderSpecificProperty `json:"providerSpecific,omitempty"`
+}
+
+// ProviderSpecificProperty is a property of an endpoint specific to a
+// provider. They are ignored.
+type ProviderSpecificProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Changes are the changes requested by external-dns. UpdateOld and UpdateNew
+// hold the endpoints before and after their update.
+type Changes struct {
+	Create    []*Endpoint `json:"Create"`
+	UpdateOld []*Endpoint `json:"UpdateOld"`
+	UpdateNew []*Endpoint `json:"UpdateNew"`
+	Delete    []*Endpoint `json:"Delete"`
+}
+
+// domainFilter is the domain filter returned during negotiation.
+type domainFilter struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// handler serves the webhook API for the zones of a provider.
+type handler struct {
+	p     *dnsupdate.Provider
+	zones []string
+}
+
+// NewHandler returns a handler serving the webhook API to manage the records
+// of the given zones with a provider. The zones are advertised to
+// external-dns as its domain filter.
+func NewHandler(p *dnsupdate.Provider, zones ...string) http.Handler {
+	h := &handler{p: p}
+	for _, zone := range zones {
+		h.zones = append(h.zones, dns.Fqdn(zone))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", h.negotiate)
+	mux.HandleFunc("GET /healthz", h.health)
+	mux.HandleFunc("GET /records", h.records)
+	mux.HandleFunc("POST /records", h.applyChanges)
+	mux.HandleFunc("POST /adjustendpoints", h.adjustEndpoints)
+	return mux
+}
+
+// negotiate replies with the domain filter of the provider.
+func (h *handler) negotiate(w http.ResponseWriter, r *http.Request) {
+	filter := domainFilter{Include: []string{}, Exclude: []string{}}
+	for _, zone := range h.zones {
+		filter.Include = append(filter.Include, strings.TrimSuffix(zone, "."))
+	}
+	h.reply(w, r, filter)
+}
+
+// health reports that the webhook is running.
+func (h *handler) health(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// records replies with the records of all the zones.
+func (h *handler) records(w http.ResponseWriter, r *http.Request) {
+	endpoints := []*Endpoint{}
+	for _, zone := range h.zones {
+		zoneEndpoints, err := h.zoneEndpoints(r.Context(), zone)
+		if err != nil {
+			h.fail(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		endpoints = append(endpoints, zoneEndpoints...)
+	}
+	h.reply(w, r, endpoints)
+}
+
+// zoneEndpoints lists the records of a zone as endpoints, grouping the
+// records of each name and type.
+func (h *handler) zoneEndpoints(ctx context.Context, zone string) ([]*Endpoint, error) {
+	records, err := h.p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list records of %v: %w", zone, err)
+	}
+
+	var endpoints []*Endpoint
+	byKey := make(map[string]*Endpoint)
+	for _, record := range records {
+		rr, err := dnsupdate.ToRR(zone, record)
+		if err != nil {
+			return nil, err
+		}
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeSOA {
+			continue
+		}
+
+		name := strings.TrimSuffix(hdr.Name, ".")
+		rtype := dns.TypeToString[hdr.Rrtype]
+		key := dns.CanonicalName(hdr.Name) + " " + rtype
+		endpoint := byKey[key]
+		if endpoint == nil {
+			endpoint = &Endpoint{DNSName: name, RecordType: rtype, RecordTTL: int64(hdr.Ttl)}
+			byKey[key] = endpoint
+			endpoints = append(endpoints, endpoint)
+		}
+		endpoint.Targets = append(endpoint.Targets, target(rr))
+	}
+	return endpoints, nil
+}
+
+// target returns the data of a RR in the format of endpoint targets:
+// the presentation format, without the trailing dot of names.
+func target(rr dns.RR) string {
+	data := strings.TrimPrefix(rr.String(), rr.Header().String())
+	if rr.Header().Rrtype != dns.TypeTXT {
+		data = strings.TrimSuffix(data, ".")
+	}
+	return data
+}
+
+// applyChanges applies the changes to each zone with a single update, once
+// the updates of all the zones are validated.
+func (h *handler) applyChanges(w http.ResponseWriter, r *http.Request) {
+	var changes Changes
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		h.fail(w, r, http.StatusBadRequest, fmt.Errorf("invalid changes: %w", err))
+		return
+	}
+
+	var (
+		zones   []string
+		updates = make(map[string]*dnsupdate.Update)
+	)
+	add := func(endpoints []*Endpoint, deleted bool) error {
+		for _, endpoint := range endpoints {
+			zone, records, err := h.endpointRecords(endpoint)
+			if err != nil {
+				return err
+			}
+			update := updates[zone]
+			if update == nil {
+				update = h.p.NewUpdate(zone)
+				updates[zone] = update
+				zones = append(zones, zone)
+			}
+			if deleted {
+				update.Delete(records...)
+			} else {
+				update.Add(records...)
+			}
+		}
+		return nil
+	}
+	// Records are deleted first, so that updated records are added back
+	err := add(changes.Delete, true)
+	if err == nil {
+		err = add(changes.UpdateOld, true)
+	}
+	if err == nil {
+		err = add(changes.UpdateNew, false)
+	}
+	if err == nil {
+		err = add(changes.Create, false)
+	}
+	if err != nil {
+		h.fail(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// Check all the zones before changing any, since an update can't be
+	// rolled back once sent
+	for _, zone := range zones {
+		if err := updates[zone].Validate(r.Context()); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, dnsupdate.ErrOutOfScope) || errors.Is(err, dnsupdate.ErrProtected) || errors.Is(err, dnsupdate.ErrTooManyDeletes) {
+				status = http.StatusBadRequest
+			}
+			h.fail(w, r, status, fmt.Errorf("invalid changes to %v: %w", zone, err))
+			return
+		}
+	}
+	for _, zone := range zones {
+		if err := updates[zone].Commit(r.Context()); err != nil {
+			h.fail(w, r, http.StatusInternalServerError, fmt.Errorf("failed to update %v: %w", zone, err))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// endpointRecords returns the zone of an endpoint, and its records.
+func (h *handler) endpointRecords(endpoint *Endpoint) (string, []libdns.Record, error) {
+	fqdn := dns.Fqdn(endpoint.DNSName)
+	var zone string
+	for _, z := range h.zones {
+		if dns.IsSubDomain(z, fqdn) && len(z) > len(zone) {
+			zone = z
+		}
+	}
+	if zone == "" {
+		return "", nil, fmt.Errorf("%v isn't in any managed zone", endpoint.DNSName)
+	}
+
+	var records []libdns.Record
+	for _, t := range endpoint.Targets {
+		if strings.EqualFold(endpoint.RecordType, "TXT") && !strings.HasPrefix(t, `"`) {
+			// Unquoted text is the raw value, escaped and split into
+			// strings of 255 bytes when the record is sent
+			records = append(records, libdns.TXT{
+				Name: libdns.RelativeName(fqdn, zone),
+				TTL:  time.Duration(endpoint.RecordTTL) * time.Second,
+				Text: t,
+			})
+			continue
+		}
+		rr, err := dns.NewRR(fmt.Sprintf("%v %d IN %v %v", fqdn, endpoint.RecordTTL, endpoint.RecordType, t))
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid %v target %q of %v: %w", endpoint.RecordType, t, endpoint.DNSName, err)
+		}
+		records = append(records, dnsupdate.FromRR(zone, rr))
+	}
+	return zone, records, nil
+}
+
+// adjustEndpoints replies with the endpoints unchanged, except for the
+// properties specific to other providers, which are dropped.
+func (h *handler) adjustEndpoints(w http.ResponseWriter, r *http.Request) {
+	var endpoints []*Endpoint
+	if err := json.NewDecoder(r.Body).Decode(&endpoints); err != nil {
+		h.fail(w, r, http.StatusBadRequest, fmt.Errorf("invalid endpoints: %w", err))
+		return
+	}
+	for _, endpoint := range endpoints {
+		endpoint.ProviderSpecific = nil
+	}
+	if endpoints == nil {
+		endpoints = []*Endpoint{}
+	}
+	h.reply(w, r, endpoints)
+}
+
+// reply writes a JSON reply.
+func (h *handler) reply(w http.ResponseWriter, r *http.Request, v any) {
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Vary", "Content-Type")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log(r, err)
+	}
+}
+
+// fail replies with an error.
+func (h *handler) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	h.log(r, err)
+	http.Error(w, err.Error(), status)
+}
+
+// log logs a failed request with the logger of the provider, if any.
+func (h *handler) log(r *http.Request, err error) {
+	if h.p.Logger == nil {
+		return
+	}
+	h.p.Logger.LogAttrs(r.Context(), slog.LevelError, "external-dns webhook request failed",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Any("error", err),
+	)
+}
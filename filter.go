@@ -0,0 +1,84 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// RecordFilter selects records by name and type. Empty fields match any
+// name or type.
+type RecordFilter struct {
+	// Name relative to the zone, "@" for the zone apex.
+	Name string
+
+	// Record type, such as "TXT".
+	Type string
+}
+
+// GetRecordsFiltered lists the records of the zone matching a filter. When
+// both the name and the type are set, the records are looked up with an
+// ordinary query instead of a zone transfer.
+func (p *Provider) GetRecordsFiltered(ctx context.Context, zone string, filter RecordFilter) (_ []libdns.Record, err error) {
+	if filter.Name == "" || filter.Type == "" {
+		records, err := p.GetRecords(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+		return filterRecords(zone, records, filter)
+	}
+
+	ctx, span := p.startSpan(ctx, "GetRecordsFiltered", zone)
+	defer func() { endSpan(span, err) }()
+
+	zone, err = p.resolveZone(zone)
+	if err != nil {
+		return nil, err
+	}
+	fqdn, err := toASCII(libdns.AbsoluteName(filter.Name, zone))
+	if err != nil {
+		return nil, err
+	}
+	qtype, ok := dns.StringToType[strings.ToUpper(filter.Type)]
+	if !ok {
+		return nil, fmt.Errorf("unknown record type %q", filter.Type)
+	}
+
+	rrs, err := p.lookupRRset(ctx, fqdn, qtype)
+	if errors.Is(err, ErrNXDomain) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return unmarshalRecords(zone, rrs), nil
+}
+
+// filterRecords returns the records matching a filter.
+func filterRecords(zone string, records []libdns.Record, filter RecordFilter) ([]libdns.Record, error) {
+	var fqdn string
+	if filter.Name != "" {
+		var err error
+		fqdn, err = toASCII(libdns.AbsoluteName(filter.Name, zone))
+		if err != nil {
+			return nil, err
+		}
+		fqdn = dns.CanonicalName(fqdn)
+	}
+
+	return slices.DeleteFunc(records, func(record libdns.Record) bool {
+		r := record.RR()
+		if filter.Type != "" && !strings.EqualFold(r.Type, filter.Type) {
+			return true
+		}
+		if fqdn != "" {
+			name, err := toASCII(libdns.AbsoluteName(r.Name, zone))
+			return err != nil || dns.CanonicalName(name) != fqdn
+		}
+		return false
+	}), nil
+}
@@ -0,0 +1,253 @@
+package dnsupdate
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/miekg/dns"
+)
+
+// gssTSIG is the TSIG algorithm name for GSS-TSIG, as defined in RFC 3645.
+const gssTSIG = "gss-tsig."
+
+const defaultKerberosConfig = "/etc/krb5.conf"
+
+// gssRenewBefore is how long before its expiration a GSS-TSIG context is
+// renewed.
+const gssRenewBefore = 5 * time.Minute
+
+type gssContext struct {
+	key     *tsigKey
+	expires time.Time
+}
+
+// gssTSIGKey returns the GSS-TSIG key negotiated with a server, negotiating a
+// new security context if needed.
+func (p *Provider) gssTSIGKey(ctx context.Context, addr string) (*tsigKey, error) {
+	p.mu.Lock()
+	gssCtx, ok := p.gssContexts[addr]
+	p.mu.Unlock()
+	// Renew the context a bit before it expires
+	if ok && time.Now().Add(gssRenewBefore).Before(gssCtx.expires) {
+		return gssCtx.key, nil
+	}
+	oldCtx := gssCtx
+
+	gssCtx, err := p.negotiateGSSContext(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("GSS-TSIG negotiation failed: %w", err)
+	}
+
+	// The previous context is no longer needed, let the server clean it up.
+	// Failing to do so is harmless since it will expire anyway.
+	if oldCtx != nil && time.Now().Before(oldCtx.expires) {
+		p.deleteTKEY(ctx, addr, oldCtx.key)
+	}
+
+	p.mu.Lock()
+	if p.gssContexts == nil {
+		p.gssContexts = make(map[string]*gssContext)
+	}
+	p.gssContexts[addr] = gssCtx
+	p.mu.Unlock()
+
+	return gssCtx.key, nil
+}
+
+// negotiateGSSContext establishes a GSS-API security context with a server
+// using Kerberos, with a TKEY exchange.
+func (p *Provider) negotiateGSSContext(ctx context.Context, addr string) (*gssContext, error) {
+	hostname := serverHostname(addr)
+	if net.ParseIP(hostname) != nil {
+		return nil, errors.New("the server address must be a host name, not an IP address")
+	}
+
+	cl, err := p.kerberosClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Destroy()
+
+	tkt, sessionKey, err := cl.GetServiceTicket("DNS/" + hostname)
+	if err != nil {
+		return nil, err
+	}
+	apReq, err := spnego.NewKRB5TokenAPREQ(cl, tkt, sessionKey, []int{gssapi.ContextFlagMutual, gssapi.ContextFlagInteg}, []int{flags.APOptionMutualRequired})
+	if err != nil {
+		return nil, err
+	}
+	token, err := apReq.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	keyName := dns.Fqdn(fmt.Sprintf("%08x.sig-%v", rand.Uint32(), hostname))
+	tkey, err := p.exchangeTKEY(ctx, addr, keyName, gssTSIG, tkeyModeGSSAPI, token, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := acceptGSSContext(tkey, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gssContext{
+		key: &tsigKey{
+			name:      keyName,
+			algorithm: gssTSIG,
+			fudge:     p.tsigFudge(),
+			provider:  provider,
+		},
+		expires: time.Unix(int64(tkey.Expiration), 0),
+	}, nil
+}
+
+// acceptGSSContext processes the AP-REP sent back by the server, and returns
+// the TSIG provider for the established security context.
+func acceptGSSContext(tkey *dns.TKEY, sessionKey types.EncryptionKey) (*gssProvider, error) {
+	b, err := hex.DecodeString(tkey.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	var token spnego.KRB5Token
+	if err := token.Unmarshal(b); err != nil {
+		return nil, err
+	} else if token.IsKRBError() {
+		return nil, token.KRBError
+	} else if !token.IsAPRep() {
+		return nil, errors.New("no AP-REP in TKEY reply")
+	}
+
+	b, err = crypto.DecryptEncPart(token.APRep.EncPart, sessionKey, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return nil, err
+	}
+	var encPart messages.EncAPRepPart
+	if err := encPart.Unmarshal(b); err != nil {
+		return nil, err
+	}
+
+	// If the server asserted a subkey, it protects messages in both
+	// directions, see RFC 4121 section 2
+	if encPart.Subkey.KeyType != 0 {
+		return &gssProvider{key: encPart.Subkey, flags: gssapi.MICTokenFlagAcceptorSubkey}, nil
+	}
+	return &gssProvider{key: sessionKey}, nil
+}
+
+// kerberosClient returns a Kerberos client logged in with the configured
+// credentials, or with the credentials cache if none are configured.
+func (p *Provider) kerberosClient() (*client.Client, error) {
+	configPath := p.KerberosConfig
+	if configPath == "" {
+		configPath = defaultKerberosConfig
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Kerberos configuration: %w", err)
+	}
+
+	// Active Directory doesn't support FAST
+	var cl *client.Client
+	switch {
+	case p.KerberosKeytab != "":
+		kt, err := keytab.Load(p.KerberosKeytab)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Kerberos keytab: %w", err)
+		}
+		cl = client.NewWithKeytab(p.KerberosUsername, p.KerberosRealm, kt, cfg, client.DisablePAFXFAST(true))
+	case p.KerberosPassword != "":
+		cl = client.NewWithPassword(p.KerberosUsername, p.KerberosRealm, p.KerberosPassword, cfg, client.DisablePAFXFAST(true))
+	default:
+		ccachePath := strings.TrimPrefix(os.Getenv("KRB5CCNAME"), "FILE:")
+		if ccachePath == "" {
+			ccachePath = fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+		}
+		ccache, err := credentials.LoadCCache(ccachePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Kerberos credentials cache: %w", err)
+		}
+		return client.NewFromCCache(ccache, cfg, client.DisablePAFXFAST(true))
+	}
+
+	if err := cl.Login(); err != nil {
+		return nil, err
+	}
+	return cl, nil
+}
+
+// serverHostname returns the host name of a server address.
+func serverHostname(addr string) string {
+	if u, err := url.Parse(addr); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+	addr = trimTransport(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// gssProvider implements dns.TsigProvider for GSS-TSIG with Kerberos, using
+// the MIC tokens defined in RFC 4121.
+type gssProvider struct {
+	key   types.EncryptionKey
+	flags byte
+}
+
+func (p *gssProvider) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	if dns.CanonicalName(t.Algorithm) != gssTSIG {
+		return nil, dns.ErrKeyAlg
+	}
+
+	token := gssapi.MICToken{
+		Flags:   p.flags,
+		Payload: msg,
+	}
+	if err := token.SetChecksum(p.key, keyusage.GSSAPI_INITIATOR_SIGN); err != nil {
+		return nil, err
+	}
+	return token.Marshal()
+}
+
+func (p *gssProvider) Verify(msg []byte, t *dns.TSIG) error {
+	if dns.CanonicalName(t.Algorithm) != gssTSIG {
+		return dns.ErrKeyAlg
+	}
+
+	mac, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+
+	var token gssapi.MICToken
+	if err := token.Unmarshal(mac, true); err != nil {
+		return err
+	}
+	token.Payload = msg
+	if ok, err := token.Verify(p.key, keyusage.GSSAPI_ACCEPTOR_SIGN); !ok {
+		return fmt.Errorf("%w: %v", dns.ErrSig, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package dnsupdate
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile converts internationalized domain names. Labels which aren't
+// valid host names, such as "_acme-challenge" or "*", are left as is.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.StrictDomainName(false),
+	idna.Transitional(false),
+)
+
+// toASCII converts a name containing Unicode labels to its punycode ("xn--")
+// form, as sent on the wire.
+func toASCII(name string) (string, error) {
+	if isASCII(name) {
+		return name, nil
+	}
+
+	ascii, err := idnaProfile.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid internationalized domain name %q: %w", name, err)
+	}
+	return ascii, nil
+}
+
+// toUnicode converts the punycode labels of a name back to Unicode. Names
+// which can't be converted are returned unchanged.
+func toUnicode(name string) string {
+	if !strings.Contains(name, "xn--") {
+		return name
+	}
+
+	unicode, err := idnaProfile.ToUnicode(name)
+	if err != nil {
+		return name
+	}
+	return unicode
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
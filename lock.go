@@ -0,0 +1,31 @@
+package dnsupdate
+
+import (
+	"context"
+
+	"github.com/miekg/dns"
+)
+
+// lockZone locks a zone until the returned function is called, so that
+// concurrent changes to the same zone don't interleave.
+func (p *Provider) lockZone(ctx context.Context, zone string) (unlock func(), err error) {
+	key := dns.CanonicalName(zone)
+
+	p.mu.Lock()
+	if p.zoneLocks == nil {
+		p.zoneLocks = make(map[string]chan struct{})
+	}
+	l, ok := p.zoneLocks[key]
+	if !ok {
+		l = make(chan struct{}, 1)
+		p.zoneLocks[key] = l
+	}
+	p.mu.Unlock()
+
+	select {
+	case l <- struct{}{}:
+		return func() { <-l }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
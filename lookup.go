@@ -0,0 +1,73 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// defaultLookupTypes are the record types looked up for each name when zone
+// transfers are refused.
+var defaultLookupTypes = []string{"A", "AAAA", "CAA", "CNAME", "MX", "NS", "SRV", "TXT"}
+
+// lookupRecords lists the records of the configured names in the zone with
+// ordinary queries, as a replacement for zone transfers.
+func (p *Provider) lookupRecords(ctx context.Context, zone string) ([]dns.RR, error) {
+	types := p.LookupTypes
+	if len(types) == 0 {
+		types = defaultLookupTypes
+	}
+
+	var rrs []dns.RR
+	for _, name := range p.LookupNames {
+		fqdn, err := toASCII(libdns.AbsoluteName(name, zone))
+		if err != nil {
+			return nil, err
+		}
+
+	types:
+		for _, t := range types {
+			qtype, ok := dns.StringToType[t]
+			if !ok {
+				return nil, fmt.Errorf("unknown record type %q", t)
+			}
+
+			rrset, err := p.lookupRRset(ctx, fqdn, qtype)
+			if errors.Is(err, ErrNXDomain) {
+				// The name doesn't exist, skip the other types
+				break types
+			} else if err != nil {
+				return nil, err
+			}
+			rrs = append(rrs, rrset...)
+		}
+	}
+	return rrs, nil
+}
+
+// lookupRRset queries the records of a name and type with an ordinary
+// query.
+func (p *Provider) lookupRRset(ctx context.Context, fqdn string, qtype uint16) ([]dns.RR, error) {
+	var query dns.Msg
+	query.SetQuestion(fqdn, qtype)
+	query.RecursionDesired = false
+
+	reply, err := p.roundTrip(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip records of other types, such as CNAME records returned for an
+	// alias
+	var rrs []dns.RR
+	for _, rr := range reply.Answer {
+		hdr := rr.Header()
+		if hdr.Rrtype == qtype && dns.CanonicalName(hdr.Name) == dns.CanonicalName(fqdn) {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs, nil
+}
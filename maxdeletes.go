@@ -0,0 +1,96 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ErrTooManyDeletes is returned when an operation would delete more records
+// than allowed by MaxDeletes.
+var ErrTooManyDeletes = errors.New("too many records deleted")
+
+// maxDeletes returns the number of records which an operation may delete in
+// a zone of the given size, according to MaxDeletes.
+func (p *Provider) maxDeletes(total int) (int, error) {
+	if s, ok := strings.CutSuffix(p.MaxDeletes, "%"); ok {
+		percent, err := strconv.ParseFloat(s, 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return 0, fmt.Errorf("invalid maximum deletes %q", p.MaxDeletes)
+		}
+		return int(float64(total) * percent / 100), nil
+	}
+	n, err := strconv.Atoi(p.MaxDeletes)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid maximum deletes %q", p.MaxDeletes)
+	}
+	return n, nil
+}
+
+// checkMaxDeletes counts the records of the zone which an update message
+// would delete, not counting the records it adds back, and checks it against
+// MaxDeletes.
+func (p *Provider) checkMaxDeletes(ctx context.Context, msg *dns.Msg) error {
+	if p.MaxDeletes == "" || !slices.ContainsFunc(msg.Ns, func(rr dns.RR) bool {
+		class := rr.Header().Class
+		return class == dns.ClassANY || class == dns.ClassNONE
+	}) {
+		return nil
+	}
+
+	zone := msg.Question[0].Name
+	current, err := p.transferZone(ctx, zone)
+	if err != nil {
+		return fmt.Errorf("failed to count deleted records: %w", err)
+	}
+
+	// The SOA record can't be deleted, so it isn't counted
+	total, deleted := 0, 0
+	for _, rr := range current {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			continue
+		}
+		total++
+		if deletedBy(rr, msg.Ns) {
+			deleted++
+		}
+	}
+	limit, err := p.maxDeletes(total)
+	if err != nil {
+		return err
+	}
+	if deleted > limit {
+		return fmt.Errorf("%w: %d of the %d records of %v, at most %v allowed", ErrTooManyDeletes, deleted, total, zone, p.MaxDeletes)
+	}
+	return nil
+}
+
+// deletedBy reports whether a record is deleted by the changes of an update
+// section, and not added back.
+func deletedBy(rr dns.RR, changes []dns.RR) bool {
+	hdr := rr.Header()
+	deleted := slices.ContainsFunc(changes, func(change dns.RR) bool {
+		h := change.Header()
+		if dns.CanonicalName(h.Name) != dns.CanonicalName(hdr.Name) {
+			return false
+		}
+		switch h.Class {
+		case dns.ClassANY:
+			return h.Rrtype == dns.TypeANY || h.Rrtype == hdr.Rrtype
+		case dns.ClassNONE:
+			match := dns.Copy(change)
+			match.Header().Class = dns.ClassINET
+			return dns.IsDuplicate(match, rr)
+		default:
+			return false
+		}
+	})
+	return deleted && !slices.ContainsFunc(changes, func(change dns.RR) bool {
+		return change.Header().Class == dns.ClassINET && dns.IsDuplicate(change, rr)
+	})
+}
@@ -0,0 +1,118 @@
+package dnsupdate_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/libdns/dnsupdate"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+func TestMaxDeletes(t *testing.T) {
+	srv, p := newTestServer(t)
+	ctx := context.Background()
+
+	recs := txtRecords(10)
+	if _, err := p.AppendRecords(ctx, testZone, recs); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		max     string
+		deletes int
+		ok      bool
+	}{
+		{"3", 3, true},
+		{"3", 4, false},
+		{"20%", 2, true},
+		{"20%", 3, false},
+	} {
+		p.MaxDeletes = test.max
+		_, err := p.DeleteRecords(ctx, testZone, recs[:test.deletes])
+		if test.ok && err != nil {
+			t.Errorf("deleting %d records with MaxDeletes %v: %v", test.deletes, test.max, err)
+		} else if !test.ok && !errors.Is(err, dnsupdate.ErrTooManyDeletes) {
+			t.Errorf("deleting %d records with MaxDeletes %v: error = %v, want %v", test.deletes, test.max, err, dnsupdate.ErrTooManyDeletes)
+		}
+		if test.ok {
+			if _, err := p.AppendRecords(ctx, testZone, recs[:test.deletes]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := serverRecords(srv); len(got) != len(recs) {
+			t.Fatalf("server holds %d records, want %d", len(got), len(recs))
+		}
+	}
+}
+
+func TestMaxDeletesSet(t *testing.T) {
+	srv, p := newTestServer(t)
+	p.MaxDeletes = "1"
+	ctx := context.Background()
+
+	if _, err := p.AppendRecords(ctx, testZone, []libdns.Record{
+		libdns.TXT{Name: "a", Text: "1"},
+		libdns.TXT{Name: "a", Text: "2"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Setting the same records again doesn't delete any
+	if _, err := p.SetRecords(ctx, testZone, []libdns.Record{
+		libdns.TXT{Name: "a", Text: "1"},
+		libdns.TXT{Name: "a", Text: "2"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Replacing both records deletes two
+	_, err := p.SetRecords(ctx, testZone, []libdns.Record{libdns.TXT{Name: "a", Text: "3"}})
+	if !errors.Is(err, dnsupdate.ErrTooManyDeletes) {
+		t.Errorf("SetRecords error = %v, want %v", err, dnsupdate.ErrTooManyDeletes)
+	}
+	if got := serverRecords(srv); len(got) != 2 {
+		t.Errorf("server holds %d records, want 2", len(got))
+	}
+}
+
+func TestMaxDeletesCommit(t *testing.T) {
+	srv, p := newTestServer(t)
+	ctx := context.Background()
+
+	recs := txtRecords(2)
+	if _, err := p.AppendRecords(ctx, testZone, recs); err != nil {
+		t.Fatal(err)
+	}
+	p.MaxDeletes = "1"
+	err := p.NewUpdate(testZone).Delete(recs...).Commit(ctx)
+	if !errors.Is(err, dnsupdate.ErrTooManyDeletes) {
+		t.Errorf("Commit error = %v, want %v", err, dnsupdate.ErrTooManyDeletes)
+	}
+	if got := serverRecords(srv); len(got) != 2 {
+		t.Errorf("server holds %d records, want 2", len(got))
+	}
+}
+
+func TestMaxDeletesDo(t *testing.T) {
+	srv, p := newTestServer(t)
+	ctx := context.Background()
+
+	if _, err := p.AppendRecords(ctx, testZone, txtRecords(2)); err != nil {
+		t.Fatal(err)
+	}
+	p.MaxDeletes = "1"
+	var msg dns.Msg
+	msg.SetUpdate(testZone)
+	msg.RemoveName([]dns.RR{
+		&dns.ANY{Hdr: dns.RR_Header{Name: "h0." + testZone}},
+		&dns.ANY{Hdr: dns.RR_Header{Name: "h1." + testZone}},
+	})
+	_, err := p.Do(ctx, &msg)
+	if !errors.Is(err, dnsupdate.ErrTooManyDeletes) {
+		t.Errorf("Do error = %v, want %v", err, dnsupdate.ErrTooManyDeletes)
+	}
+	if got := serverRecords(srv); len(got) != 2 {
+		t.Errorf("server holds %d records, want 2", len(got))
+	}
+}
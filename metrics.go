@@ -0,0 +1,90 @@
+package dnsupdate
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds Prometheus collectors for the exchanges of a Provider with
+// DNS servers. It must be registered, for instance with
+// prometheus.MustRegister, and can be shared by several providers.
+type Metrics struct {
+	requests  *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+	transfers *prometheus.HistogramVec
+}
+
+// NewMetrics creates the collectors, with names starting with
+// "dnsupdate_".
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dnsupdate_requests_total",
+			Help: "Number of messages sent to DNS servers, by operation and response code.",
+		}, []string{"op", "rcode"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "dnsupdate_request_duration_seconds",
+			Help:    "Time taken by exchanges with DNS servers, by operation.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"op"}),
+		transfers: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "dnsupdate_transfer_records",
+			Help:    "Number of records received in zone transfers, by operation.",
+			Buckets: prometheus.ExponentialBuckets(10, 4, 8),
+		}, []string{"op"}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.duration.Describe(ch)
+	m.transfers.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.duration.Collect(ch)
+	m.transfers.Collect(ch)
+}
+
+// observe records an exchange with a server.
+func (m *Metrics) observe(query, reply *dns.Msg, err error, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	op := metricsOp(query)
+	rcode := "error"
+	if err == nil {
+		rcode = dns.RcodeToString[reply.Rcode]
+	}
+	m.requests.WithLabelValues(op, rcode).Inc()
+	m.duration.WithLabelValues(op).Observe(duration.Seconds())
+	if err == nil && (op == "axfr" || op == "ixfr") {
+		m.transfers.WithLabelValues(op).Observe(float64(len(reply.Answer)))
+	}
+}
+
+// metricsOp returns the operation label of a query.
+func metricsOp(query *dns.Msg) string {
+	switch {
+	case query.Opcode == dns.OpcodeUpdate:
+		return "update"
+	case query.Opcode == dns.OpcodeNotify:
+		return "notify"
+	case len(query.Question) == 0:
+		return "query"
+	case query.Question[0].Qtype == dns.TypeAXFR:
+		return "axfr"
+	case query.Question[0].Qtype == dns.TypeIXFR:
+		return "ixfr"
+	default:
+		return "query"
+	}
+}
+
+var _ prometheus.Collector = (*Metrics)(nil)
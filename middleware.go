@@ -0,0 +1,34 @@
+package dnsupdate
+
+import (
+	"context"
+
+	"github.com/miekg/dns"
+)
+
+// ExchangeFunc sends a message to a server, and returns the reply.
+type ExchangeFunc func(ctx context.Context, server string, msg *dns.Msg) (*dns.Msg, error)
+
+// Middleware wraps the exchanges with servers, to inspect or change the
+// messages and the replies, for instance to add EDNS0 options, record
+// custom telemetry or enforce policies. Messages are signed by the
+// innermost function, after all the changes.
+type Middleware func(next ExchangeFunc) ExchangeFunc
+
+// exchangeWithMiddleware sends a message to a server through the
+// middleware chain, the first middleware being the outermost one. Each
+// exchange is given its own copy of the message, so that changes don't
+// accumulate over retries.
+func (p *Provider) exchangeWithMiddleware(ctx context.Context, addr string, query *dns.Msg, s signer) (*dns.Msg, error) {
+	if len(p.Middleware) == 0 {
+		return p.exchange(ctx, addr, query, s)
+	}
+
+	next := ExchangeFunc(func(ctx context.Context, addr string, msg *dns.Msg) (*dns.Msg, error) {
+		return p.exchange(ctx, addr, msg, s)
+	})
+	for i := len(p.Middleware) - 1; i >= 0; i-- {
+		next = p.Middleware[i](next)
+	}
+	return next(ctx, addr, query.Copy())
+}
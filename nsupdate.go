@@ -0,0 +1,258 @@
+package dnsupdate
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// RunNSUpdate executes a script in the input format of nsupdate, sending its
+// updates through the provider. Each update is sent atomically, as with
+// Provider.NewUpdate.
+//
+// The zone, class, ttl, prereq, update, add, delete and send commands are
+// supported, and a blank line sends the pending update like send. The zone
+// command is required, and names are fully qualified like in nsupdate. The
+// server and keys are taken from the provider: the server, local, key,
+// gsstsig and realm commands are rejected. The show, answer, debug and
+// version commands are ignored. As in nsupdate, added records without a TTL
+// get the one set with the ttl command, and are rejected if there is none.
+func (p *Provider) RunNSUpdate(ctx context.Context, script io.Reader) error {
+	s := nsupdateScript{p: p}
+	scanner := bufio.NewScanner(script)
+	for line := 1; scanner.Scan(); line++ {
+		if err := s.exec(ctx, scanner.Text()); errors.Is(err, errNSUpdateQuit) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return s.send(ctx)
+}
+
+var errNSUpdateQuit = errors.New("quit")
+
+// nsupdateScript holds the state of a nsupdate script.
+type nsupdateScript struct {
+	p      *Provider
+	zone   string
+	ttl    uint32
+	hasTTL bool
+	query  *dns.Msg
+}
+
+// exec executes a line of a script.
+func (s *nsupdateScript) exec(ctx context.Context, line string) error {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, ";") {
+		return nil
+	}
+
+	cmd, args := cutField(line)
+	switch cmd {
+	case "", "send":
+		return s.send(ctx)
+	case "zone":
+		zone, _ := cutField(args)
+		if zone == "" {
+			return fmt.Errorf("missing zone name")
+		}
+		ascii, err := toASCII(dns.Fqdn(zone))
+		if err != nil {
+			return err
+		}
+		s.zone = ascii
+		return nil
+	case "class":
+		if class, _ := cutField(args); !strings.EqualFold(class, "IN") {
+			return fmt.Errorf("unsupported class %q", class)
+		}
+		return nil
+	case "ttl":
+		ttl, err := strconv.ParseUint(strings.TrimSpace(args), 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid TTL: %w", err)
+		}
+		s.ttl = uint32(ttl)
+		s.hasTTL = true
+		return nil
+	case "prereq":
+		return s.prereq(args)
+	case "update":
+		op, args := cutField(args)
+		return s.update(op, args)
+	case "add", "delete", "del":
+		return s.update(cmd, args)
+	case "show", "answer", "debug", "version":
+		return nil
+	case "quit":
+		if err := s.send(ctx); err != nil {
+			return err
+		}
+		return errNSUpdateQuit
+	case "server", "local", "key", "gsstsig", "oldgsstsig", "realm":
+		return fmt.Errorf("unsupported command %q, configure the provider instead", cmd)
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// message returns the pending update message.
+func (s *nsupdateScript) message() (*dns.Msg, error) {
+	if s.zone == "" {
+		return nil, fmt.Errorf("no zone specified, use the zone command first")
+	}
+	if s.query == nil {
+		s.query = new(dns.Msg)
+		s.query.SetUpdate(s.zone)
+	}
+	return s.query, nil
+}
+
+// prereq adds a prerequisite to the pending update.
+func (s *nsupdateScript) prereq(args string) error {
+	query, err := s.message()
+	if err != nil {
+		return err
+	}
+
+	kind, args := cutField(args)
+	switch kind {
+	case "nxdomain", "yxdomain":
+		rr, err := parseNSUpdateRR(args, 0, false, false)
+		if err != nil {
+			return err
+		}
+		if kind == "nxdomain" {
+			query.NameNotUsed([]dns.RR{rr})
+		} else {
+			query.NameUsed([]dns.RR{rr})
+		}
+	case "nxrrset", "yxrrset":
+		rr, err := parseNSUpdateRR(args, 0, false, true)
+		if err != nil {
+			return err
+		}
+		switch {
+		case kind == "nxrrset":
+			query.RRsetNotUsed([]dns.RR{rr})
+		case isEmptyRR(rr):
+			query.RRsetUsed([]dns.RR{rr})
+		default:
+			query.Used([]dns.RR{rr})
+		}
+	default:
+		return fmt.Errorf("unknown prerequisite %q", kind)
+	}
+	return nil
+}
+
+// update adds a change to the pending update.
+func (s *nsupdateScript) update(op, args string) error {
+	query, err := s.message()
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case "add":
+		rr, err := parseNSUpdateRR(args, s.ttl, !s.hasTTL, true)
+		if err != nil {
+			return err
+		} else if isEmptyRR(rr) {
+			return fmt.Errorf("missing record data")
+		}
+		query.Insert([]dns.RR{rr})
+	case "delete", "del":
+		rr, err := parseNSUpdateRR(args, 0, false, false)
+		if err != nil {
+			return err
+		}
+		switch {
+		case rr.Header().Rrtype == dns.TypeANY:
+			query.RemoveName([]dns.RR{rr})
+		case isEmptyRR(rr):
+			query.RemoveRRset([]dns.RR{rr})
+		default:
+			query.Remove([]dns.RR{rr})
+		}
+	default:
+		return fmt.Errorf("unknown update operation %q", op)
+	}
+	return nil
+}
+
+// send sends the pending update, if any.
+func (s *nsupdateScript) send(ctx context.Context) error {
+	if s.query == nil {
+		return nil
+	}
+	query := s.query
+	s.query = nil
+	return s.p.sendAtomicUpdate(ctx, query)
+}
+
+// parseNSUpdateRR parses a record in the "name [ttl] [class] [type [data]]"
+// format used by nsupdate. The TTL defaults to ttl, unless it's required. If
+// the type is missing, an ANY RR is returned, unless a type is required.
+func parseNSUpdateRR(s string, ttl uint32, requireTTL, requireType bool) (dns.RR, error) {
+	name, rest := cutField(s)
+	if name == "" {
+		return nil, fmt.Errorf("missing name")
+	}
+	name, err := toASCII(dns.Fqdn(name))
+	if err != nil {
+		return nil, err
+	}
+
+	field, rest := cutField(rest)
+	if n, err := strconv.ParseUint(field, 10, 32); err == nil {
+		ttl = uint32(n)
+		field, rest = cutField(rest)
+	} else if requireTTL {
+		return nil, fmt.Errorf("missing TTL, set it in the record or with the ttl command")
+	}
+	if strings.EqualFold(field, "IN") {
+		field, rest = cutField(rest)
+	}
+
+	if field == "" {
+		if requireType {
+			return nil, fmt.Errorf("missing record type")
+		}
+		return &dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeANY, Class: dns.ClassINET}}, nil
+	}
+	rrtype, ok := dns.StringToType[strings.ToUpper(field)]
+	if !ok {
+		return nil, fmt.Errorf("unknown record type %q", field)
+	}
+	if strings.TrimSpace(rest) == "" {
+		return &dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}}, nil
+	}
+	return dns.NewRR(fmt.Sprintf("%v %v IN %v %v", name, ttl, dns.TypeToString[rrtype], rest))
+}
+
+// isEmptyRR returns true if a RR parsed by parseNSUpdateRR has no data.
+func isEmptyRR(rr dns.RR) bool {
+	_, ok := rr.(*dns.ANY)
+	return ok
+}
+
+// cutField returns the first whitespace-separated field of s, and the rest
+// of s.
+func cutField(s string) (field, rest string) {
+	s = strings.TrimLeft(s, " \t")
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
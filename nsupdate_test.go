@@ -0,0 +1,117 @@
+package dnsupdate_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/libdns/dnsupdate"
+	"github.com/miekg/dns"
+)
+
+func TestRunNSUpdate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		script string
+		// Prerequisites and updates of each message sent
+		msgs [][]string
+		err  string
+	}{{
+		name:   "add",
+		script: "zone example.org\nupdate add www.example.org 300 A 192.0.2.1\nsend\n",
+		msgs:   [][]string{{"update www.example.org.\t300\tIN\tA\t192.0.2.1"}},
+	}, {
+		name:   "default ttl",
+		script: "zone example.org\nttl 60\nadd www.example.org IN TXT \"a b\"\n",
+		msgs:   [][]string{{"update www.example.org.\t60\tIN\tTXT\t\"a b\""}},
+	}, {
+		name:   "missing ttl",
+		script: "zone example.org\nupdate add www.example.org A 192.0.2.1\n",
+		err:    "line 2: missing TTL",
+	}, {
+		name:   "delete",
+		script: "zone example.org\ndel a.example.org\ndel b.example.org A\ndel c.example.org A 192.0.2.1\n",
+		msgs: [][]string{{
+			"update a.example.org.\t0\tCLASS255\tANY\t",
+			"update b.example.org.\t0\tCLASS255\tA\t",
+			"update c.example.org.\t0\tNONE\tA\t192.0.2.1",
+		}},
+	}, {
+		name: "prerequisites",
+		script: "zone example.org\n" +
+			"prereq nxdomain a.example.org\n" +
+			"prereq yxdomain b.example.org\n" +
+			"prereq nxrrset c.example.org A\n" +
+			"prereq yxrrset d.example.org A\n" +
+			"prereq yxrrset e.example.org A 192.0.2.1\n" +
+			"add a.example.org 60 A 192.0.2.1\n",
+		msgs: [][]string{{
+			"prereq a.example.org.\t0\tNONE\tANY\t",
+			"prereq b.example.org.\t0\tCLASS255\tANY\t",
+			"prereq c.example.org.\t0\tNONE\tA\t",
+			"prereq d.example.org.\t0\tCLASS255\tA\t",
+			"prereq e.example.org.\t0\tIN\tA\t192.0.2.1",
+			"update a.example.org.\t60\tIN\tA\t192.0.2.1",
+		}},
+	}, {
+		name: "several messages",
+		script: "; comment\nzone example.org\nadd a.example.org 60 A 192.0.2.1\n\n" +
+			"add b.example.org 60 A 192.0.2.2\nquit\nadd c.example.org 60 A 192.0.2.3\n",
+		msgs: [][]string{
+			{"update a.example.org.\t60\tIN\tA\t192.0.2.1"},
+			{"update b.example.org.\t60\tIN\tA\t192.0.2.2"},
+		},
+	}, {
+		name:   "no zone",
+		script: "update add www.example.org 300 A 192.0.2.1\n",
+		err:    "line 1: no zone specified",
+	}, {
+		name:   "server",
+		script: "server 192.0.2.1\n",
+		err:    `line 1: unsupported command "server"`,
+	}, {
+		name:   "unknown type",
+		script: "zone example.org\nadd www.example.org 60 FOO bar\n",
+		err:    `line 2: unknown record type "FOO"`,
+	}, {
+		name:   "missing data",
+		script: "zone example.org\nadd www.example.org 60 A\n",
+		err:    "line 2: missing record data",
+	}, {
+		name:   "class",
+		script: "class CH\n",
+		err:    `line 1: unsupported class "CH"`,
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			var msgs [][]string
+			p := &dnsupdate.Provider{
+				Addr:   "127.0.0.1:53",
+				DryRun: true,
+				DryRunFunc: func(msg *dns.Msg) {
+					var rrs []string
+					for _, rr := range msg.Answer {
+						rrs = append(rrs, "prereq "+rr.String())
+					}
+					for _, rr := range msg.Ns {
+						rrs = append(rrs, "update "+rr.String())
+					}
+					msgs = append(msgs, rrs)
+				},
+			}
+
+			err := p.RunNSUpdate(context.Background(), strings.NewReader(test.script))
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Fatalf("RunNSUpdate error = %v, want %q", err, test.err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(msgs, test.msgs, slices.Equal) {
+				t.Errorf("sent %q, want %q", msgs, test.msgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package dnsupdate
+
+import (
+	"context"
+	"time"
+)
+
+// callOptions override the configuration of a provider for the operations
+// made with a context.
+type callOptions struct {
+	servers []string
+	timeout time.Duration
+	key     *TSIGKey
+	view    string
+
+	protectedChanges bool
+}
+
+type callOptionsKey struct{}
+
+// overridesExchanges reports whether the options change how messages are
+// exchanged with servers, which the queued updates don't remember.
+func (opts callOptions) overridesExchanges() bool {
+	return len(opts.servers) > 0 || opts.timeout > 0 || opts.key != nil || opts.view != ""
+}
+
+func callOptionsFrom(ctx context.Context) callOptions {
+	opts, _ := ctx.Value(callOptionsKey{}).(callOptions)
+	return opts
+}
+
+func withCallOptions(ctx context.Context, update func(opts *callOptions)) context.Context {
+	opts := callOptionsFrom(ctx)
+	update(&opts)
+	return context.WithValue(ctx, callOptionsKey{}, opts)
+}
+
+// WithServer returns a context making the operations of providers use the
+// given server addresses instead of the configured ones, so that a single
+// provider can manage zones hosted on different servers. Addresses have the
+// same syntax as Provider.Addr, except DNS stamps.
+func WithServer(ctx context.Context, addrs ...string) context.Context {
+	return withCallOptions(ctx, func(opts *callOptions) {
+		opts.servers = addrs
+	})
+}
+
+// WithTimeout returns a context making the operations of providers give up
+// on a server after the given time, then trying other servers or retrying
+// as usual. It limits each exchange with a server, unlike a context
+// deadline, which limits the whole operation.
+func WithTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return withCallOptions(ctx, func(opts *callOptions) {
+		opts.timeout = timeout
+	})
+}
+
+// WithKey returns a context making the operations of providers sign
+// messages with the given TSIG key, instead of the configured keys.
+func WithKey(ctx context.Context, key TSIGKey) context.Context {
+	return withCallOptions(ctx, func(opts *callOptions) {
+		opts.key = &key
+	})
+}
+
+// WithView returns a context making the operations of providers use the
+// server addresses and TSIG key of a view configured in Provider.Views, to
+// manage a view of zones served by split-horizon servers. Keys and servers
+// set with WithKey and WithServer take precedence. Cached records, IXFR
+// snapshots and zone files aren't used with a view, since the contents of
+// the zones depend on it.
+func WithView(ctx context.Context, name string) context.Context {
+	return withCallOptions(ctx, func(opts *callOptions) {
+		opts.view = name
+	})
+}
+
+// WithProtectedChanges returns a context allowing the operations of
+// providers to delete or replace the records matching
+// Provider.ProtectedRecords.
+func WithProtectedChanges(ctx context.Context) context.Context {
+	return withCallOptions(ctx, func(opts *callOptions) {
+		opts.protectedChanges = true
+	})
+}
@@ -0,0 +1,93 @@
+package dnsupdate
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// maxIdleConns is the maximum number of idle connections kept per server.
+	maxIdleConns = 2
+	// idleConnTimeout is the duration after which idle connections are
+	// discarded, since servers are likely to have closed them already,
+	// unless the server advertised its own timeout.
+	idleConnTimeout = 20 * time.Second
+)
+
+type idleConn struct {
+	net.Conn
+	expires time.Time
+}
+
+// getConn returns an idle connection to the server if there is one, or
+// establishes a new connection otherwise.
+func (p *Provider) getConn(ctx context.Context, network, addr string) (conn net.Conn, reused bool, err error) {
+	key := network + "/" + addr
+
+	p.mu.Lock()
+	for len(p.idle[key]) > 0 {
+		conns := p.idle[key]
+		c := conns[len(conns)-1]
+		p.idle[key] = conns[:len(conns)-1]
+		if time.Now().Before(c.expires) {
+			p.mu.Unlock()
+			return c.Conn, true, nil
+		}
+		c.Close()
+	}
+	p.mu.Unlock()
+
+	conn, err = p.dial(ctx, network, addr)
+	return conn, false, err
+}
+
+// putConn returns a healthy connection to the pool of idle connections, for
+// at most the given idle timeout.
+func (p *Provider) putConn(network, addr string, conn net.Conn, timeout time.Duration) {
+	key := network + "/" + addr
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.idle[key]) >= maxIdleConns || timeout <= 0 {
+		conn.Close()
+		return
+	}
+	if p.idle == nil {
+		p.idle = make(map[string][]idleConn)
+	}
+	p.idle[key] = append(p.idle[key], idleConn{conn, time.Now().Add(timeout)})
+}
+
+// withKeepalive adds the edns-tcp-keepalive option to a query, defined in
+// RFC 7828, asking the server to keep the connection open between queries.
+func withKeepalive(query *dns.Msg) *dns.Msg {
+	if query.IsEdns0() == nil {
+		return query
+	}
+
+	query = query.Copy()
+	opt := query.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE})
+	return query
+}
+
+// keepaliveTimeout returns how long a connection can be kept idle, using the
+// timeout advertised by the server in the edns-tcp-keepalive option, if any.
+func keepaliveTimeout(reply *dns.Msg) time.Duration {
+	timeout := idleConnTimeout
+	if opt := reply.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			if keepalive, ok := option.(*dns.EDNS0_TCP_KEEPALIVE); ok && keepalive.Timeout > 0 {
+				// The timeout is expressed in units of 100 milliseconds.
+				// Keep a margin so that the server doesn't close the
+				// connection while a query is being sent.
+				timeout = time.Duration(keepalive.Timeout) * 100 * time.Millisecond * 9 / 10
+			}
+		}
+	}
+	return timeout
+}
@@ -0,0 +1,126 @@
+package dnsupdate
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// propagationInterval is the interval between checks of WaitPropagated.
+const propagationInterval = 2 * time.Second
+
+// WaitPropagated waits until the records are served by all the name servers
+// of the zone, as listed in its NS records, or by the given servers, such as
+// "192.0.2.1:53". Given servers are sent recursive queries, so they can be
+// resolvers. It returns when the context is done if the records are still
+// missing somewhere.
+func (p *Provider) WaitPropagated(ctx context.Context, zone string, records []libdns.Record, servers ...string) (err error) {
+	ctx, span := p.startSpan(ctx, "WaitPropagated", zone)
+	defer func() { endSpan(span, err) }()
+
+	zone, err = p.resolveZone(zone)
+	if err != nil {
+		return err
+	}
+	rrs, err := marshalRecords(zone, records)
+	if err != nil {
+		return err
+	}
+
+	recursive := len(servers) > 0
+	if !recursive {
+		servers, err = p.nameServers(ctx, zone)
+		if err != nil {
+			return err
+		}
+	}
+
+	pending := slices.Clone(servers)
+	for {
+		pending = slices.DeleteFunc(pending, func(addr string) bool {
+			return p.serves(ctx, addr, rrs, recursive)
+		})
+		if len(pending) == 0 {
+			return nil
+		}
+
+		if err := sleep(ctx, propagationInterval); err != nil {
+			return fmt.Errorf("records not yet served by %v: %w", strings.Join(pending, ", "), err)
+		}
+	}
+}
+
+// nameServers returns the addresses of the name servers of a zone, as
+// listed in its NS records.
+func (p *Provider) nameServers(ctx context.Context, zone string) ([]string, error) {
+	var query dns.Msg
+	query.SetQuestion(zone, dns.TypeNS)
+	query.RecursionDesired = false
+
+	reply, err := p.roundTrip(ctx, &query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query name servers of %v: %w", zone, err)
+	}
+
+	var addrs []string
+	for _, rr := range reply.Answer {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+
+		ips, err := net.DefaultResolver.LookupHost(ctx, strings.TrimSuffix(ns.Ns, "."))
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, net.JoinHostPort(ip, "53"))
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no name server found for %v", zone)
+	}
+	return addrs, nil
+}
+
+// serves returns true if a server answers with all the given RRs.
+func (p *Provider) serves(ctx context.Context, addr string, rrs []dns.RR, recursive bool) bool {
+	var (
+		keys   []rrsetKey
+		groups = make(map[rrsetKey][]dns.RR)
+	)
+	for _, rr := range rrs {
+		key := rrsetKeyOf(rr)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], rr)
+	}
+
+	for _, key := range keys {
+		var query dns.Msg
+		query.SetQuestion(key.name, key.rtype)
+		query.RecursionDesired = recursive
+
+		reply, err := p.exchange(ctx, addr, &query, nil)
+		if err != nil || reply.Rcode != dns.RcodeSuccess {
+			return false
+		}
+
+		// TTLs may have been decremented by resolvers
+		for _, rr := range groups[key] {
+			if !slices.ContainsFunc(reply.Answer, func(answer dns.RR) bool {
+				return dns.IsDuplicate(answer, rr)
+			}) {
+				return false
+			}
+		}
+	}
+	return true
+}
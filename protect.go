@@ -0,0 +1,101 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// ErrProtected is returned when an update would delete or replace records
+// matching ProtectedRecords.
+var ErrProtected = errors.New("protected records")
+
+// protectedPattern is a parsed ProtectedRecords pattern. An empty name or a
+// zero type match any.
+type protectedPattern struct {
+	name  string
+	rtype uint16
+}
+
+// parseProtectedPattern parses a ProtectedRecords pattern, a name relative
+// to the zone followed by a record type, either being "*" to match any.
+func parseProtectedPattern(pattern, zone string) (protectedPattern, error) {
+	fields := strings.Fields(pattern)
+	if len(fields) != 2 {
+		return protectedPattern{}, fmt.Errorf("invalid protected records pattern %q, expected a name and a type", pattern)
+	}
+
+	var p protectedPattern
+	if fields[0] != "*" {
+		name, err := toASCII(libdns.AbsoluteName(fields[0], zone))
+		if err != nil {
+			return protectedPattern{}, fmt.Errorf("invalid protected records pattern %q: %w", pattern, err)
+		}
+		p.name = dns.CanonicalName(name)
+	}
+	if fields[1] != "*" {
+		rtype, ok := dns.StringToType[strings.ToUpper(fields[1])]
+		if !ok {
+			return protectedPattern{}, fmt.Errorf("invalid protected records pattern %q: unknown record type", pattern)
+		}
+		p.rtype = rtype
+	}
+	return p, nil
+}
+
+// matches reports whether a change of the update section may delete or
+// replace records matching the pattern.
+func (p protectedPattern) matches(rr dns.RR) bool {
+	hdr := rr.Header()
+	if p.name != "" && dns.CanonicalName(hdr.Name) != p.name {
+		return false
+	}
+	switch {
+	case hdr.Class != dns.ClassANY && hdr.Class != dns.ClassNONE:
+		// Additions only replace the SOA record
+		return hdr.Rrtype == dns.TypeSOA && (p.rtype == 0 || p.rtype == dns.TypeSOA)
+	case hdr.Rrtype == dns.TypeANY:
+		// All the records of the name are deleted
+		return true
+	default:
+		return p.rtype == 0 || p.rtype == hdr.Rrtype
+	}
+}
+
+// checkProtected checks that an update message doesn't delete or replace
+// records matching ProtectedRecords, unless allowed with
+// WithProtectedChanges.
+func (p *Provider) checkProtected(ctx context.Context, msg *dns.Msg) error {
+	if len(p.ProtectedRecords) == 0 || callOptionsFrom(ctx).protectedChanges {
+		return nil
+	}
+
+	zone := msg.Question[0].Name
+	for _, pattern := range p.ProtectedRecords {
+		parsed, err := parseProtectedPattern(pattern, zone)
+		if err != nil {
+			return err
+		}
+		for _, rr := range msg.Ns {
+			if parsed.matches(rr) {
+				return fmt.Errorf("%w: update changes %v %v, matching %q", ErrProtected,
+					rr.Header().Name, dns.TypeToString[rr.Header().Rrtype], pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// checkChanges checks that an update message only changes names allowed by
+// Scope, and no ProtectedRecords. Operations check their whole update once,
+// before it's split into several messages.
+func (p *Provider) checkChanges(ctx context.Context, msg *dns.Msg) error {
+	if err := p.checkScope(msg); err != nil {
+		return err
+	}
+	return p.checkProtected(ctx, msg)
+}
@@ -4,141 +4,691 @@ package dnsupdate
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/libdns/libdns"
 	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
 // Provider facilitates DNS record manipulation with the DNS UPDATE protocol.
+// It is safe for concurrent use: changes to the same zone are made one
+// after the other, while other zones are updated in parallel.
 type Provider struct {
-	// DNS server address
+	// DNS server address. An "https://" URL selects DNS-over-HTTPS, a
+	// "tls://" prefix selects DNS-over-TLS, a "quic://" prefix selects
+	// DNS-over-QUIC, which requires QUICTransport, and a "unix:" prefix
+	// followed by a path selects a Unix domain socket. "sdns://" DNS stamps
+	// are also accepted, except for DNSCrypt servers. The port defaults to 53, or 853 for DNS-over-TLS and
+	// DNS-over-QUIC. If no address is configured, the primary name server
+	// listed in the zone's SOA record is used.
 	Addr string `json:"addr,omitempty"`
+
+	// Additional DNS server addresses, tried in order when the previous
+	// server can't be reached or replies with SERVFAIL, REFUSED or NOTAUTH.
+	// Updates refused by all of them are sent to the primary name server
+	// listed in the zone's SOA record.
+	Addrs []string `json:"addrs,omitempty"`
+
+	// Send updates to all the servers above in parallel, rather than to the
+	// first one handling them, for multi-primary setups or to update a
+	// hidden primary along with the public one. The policy sets which
+	// outcome counts as a success: "all" servers, a "majority" of them, or
+	// "any" of them. Otherwise updates fail with a *ReplicationError
+	// reporting the outcome for each server, and servers which applied them
+	// keep the changes. Queries are still sent to the first server replying.
+	ReplicationPolicy string `json:"replication_policy,omitempty"`
+
+	// Function called with the outcome for each server of the updates sent
+	// with ReplicationPolicy, including when some of them failed without
+	// failing the update.
+	ReplicationFunc func(zone string, results []ReplicaResult) `json:"-"`
+
+	// Client certificate presented to servers using encrypted transports
+	// which authenticate clients with mutual TLS, and its private key. Both
+	// are PEM-encoded, and the key defaults to the certificate file. The
+	// files are read again for each connection.
+	TLSCertFile string `json:"tls_cert_file,omitempty"`
+	TLSKeyFile  string `json:"tls_key_file,omitempty"`
+
+	// PEM-encoded CA certificates trusted to verify the certificates of
+	// servers using encrypted transports, instead of the system ones.
+	TLSCAFile string `json:"tls_ca_file,omitempty"`
+
+	// Name expected in the certificates of servers using encrypted
+	// transports. Defaults to the host of the server address.
+	TLSServerName string `json:"tls_server_name,omitempty"`
+
+	// Minimum TLS version for encrypted transports, such as "1.3". Defaults
+	// to 1.2.
+	TLSMinVersion string `json:"tls_min_version,omitempty"`
+
+	// Accept any certificate presented by servers using encrypted
+	// transports. This is insecure, and only meant for testing.
+	TLSInsecureSkipVerify bool `json:"tls_insecure_skip_verify,omitempty"`
+
+	// Public keys expected in the certificates of servers using encrypted
+	// transports, as base64-encoded SHA-256 digests of their
+	// SubjectPublicKeyInfo, optionally prefixed with "sha256/". Connections
+	// to servers presenting none of them are refused, even when their
+	// certificate is otherwise trusted. Combined with TLSInsecureSkipVerify,
+	// only the pins are checked.
+	TLSPins []string `json:"tls_pins,omitempty"`
+
+	// Send plain DNS messages over UDP first, and only fall back to TCP if
+	// the message is too large or the reply is truncated.
+	UDP bool `json:"udp,omitempty"`
+
+	// EDNS0 UDP buffer size advertised to servers, which is also the maximum
+	// size of messages sent over UDP. Defaults to 1232 bytes.
+	UDPSize uint16 `json:"udp_size,omitempty"`
+
+	// Don't send DNS cookies to plain DNS servers. Cookies protect against
+	// spoofed traffic, and may be required by servers under load.
+	DisableCookies bool `json:"disable_cookies,omitempty"`
+
+	// Use the name servers and the first search domain from the system
+	// resolver configuration when no address or zone is specified, instead
+	// of looking up the zone's primary name server.
+	UseSystemResolver bool `json:"use_system_resolver,omitempty"`
+
+	// TSIG key name and algorithm used to sign messages. The algorithm is
+	// one of "hmac-sha1", "hmac-sha224", "hmac-sha256", "hmac-sha384" or
+	// "hmac-sha512", and defaults to "hmac-sha256". Messages are not signed if
+	// the key name is empty.
+	TSIGKeyName   string `json:"tsig_key_name,omitempty"`
+	TSIGAlgorithm string `json:"tsig_algorithm,omitempty"`
+
+	// Base64-encoded TSIG secret. Alternatively, the secret can be read from
+	// a file, which is re-read for every message so that rotated secrets are
+	// picked up, or from an environment variable.
+	TSIGSecret     string `json:"tsig_secret,omitempty"`
+	TSIGSecretFile string `json:"tsig_secret_file,omitempty"`
+	TSIGSecretEnv  string `json:"tsig_secret_env,omitempty"`
+
+	// Time difference allowed between the client and the server clocks when
+	// checking TSIG signatures, with a precision of one second. Defaults to
+	// 5 minutes. When a server reports a larger difference with BADTIME, the
+	// message is sent again with the time of the server.
+	TSIGFudge time.Duration `json:"tsig_fudge,omitempty"`
+
+	// TSIG keys used for specific zones (and their subdomains) instead of
+	// the key above, indexed by zone name. The key of the closest enclosing
+	// zone is used, and keys set in Zones take precedence for the same zone.
+	//
+	// Deprecated: Set the Key of the zone in Zones instead.
+	ZoneKeys map[string]TSIGKey `json:"zone_keys,omitempty"`
+
+	// Server addresses and TSIG keys used for specific zones (and their
+	// subdomains), indexed by zone name, so that a single provider can
+	// manage zones hosted on different servers. Unset fields default to the
+	// configuration above.
+	Zones map[string]ZoneConfig `json:"zones,omitempty"`
+
+	// Server addresses and TSIG keys of named views, selected for some
+	// operations with WithView, to manage each view of zones served by
+	// split-horizon servers, such as BIND views matching clients by TSIG
+	// key. Unset fields default to the configuration of the zone.
+	Views map[string]ZoneConfig `json:"views,omitempty"`
+
+	// TSIG keys tried in order when a server rejects the key above with
+	// BADKEY, to rotate keys without downtime: the new key is configured
+	// first, and the old one is kept here until all the servers know the
+	// new one.
+	FallbackTSIGKeys []TSIGKey `json:"fallback_tsig_keys,omitempty"`
+
+	// Source queried for the TSIG secret every time a message is signed,
+	// instead of the secret fields above.
+	SecretSource SecretSource `json:"-"`
+
+	// Computes and verifies the MACs of TSIG signatures instead of the secret
+	// fields above, for instance with an HSM, a KMS or an agent process, so
+	// that the secret is never held in memory. It is used for all the TSIG
+	// keys, identified by the key name in the TSIG record.
+	TSIGProvider dns.TsigProvider `json:"-"`
+
+	// Path to the private key file of a SIG(0) key, as generated by
+	// dnssec-keygen, used to sign messages instead of TSIG. The public key
+	// is read from the ".key" file next to it. Only the messages sent are
+	// authenticated: replies aren't signed by servers, so they can't be
+	// verified.
+	SIG0KeyFile string `json:"sig0_key_file,omitempty"`
+
+	// Sign messages with a GSS-TSIG key negotiated with Kerberos, as required
+	// by Active Directory integrated zones. Server addresses must then use
+	// host names, so that the service principal can be derived from them.
+	GSSTSIG bool `json:"gss_tsig,omitempty"`
+
+	// Kerberos configuration file, defaulting to /etc/krb5.conf, and
+	// credentials for GSS-TSIG. If neither a keytab nor a password is set,
+	// the credentials cache of the current user is used.
+	KerberosConfig   string `json:"kerberos_config,omitempty"`
+	KerberosUsername string `json:"kerberos_username,omitempty"`
+	KerberosRealm    string `json:"kerberos_realm,omitempty"`
+	KerberosPassword string `json:"kerberos_password,omitempty"`
+	KerberosKeytab   string `json:"kerberos_keytab,omitempty"`
+
+	// Local IP address to send DNS traffic from. Defaults to the address
+	// picked by the operating system.
+	LocalAddr string `json:"local_addr,omitempty"`
+
+	// Address family, "ipv4" or "ipv6", to only use with servers given by
+	// host name. Defaults to both.
+	AddressFamily string `json:"address_family,omitempty"`
+
+	// Address family, "ipv4" or "ipv6", tried first with servers given by
+	// host name. Over TCP, the other family is tried in parallel when the
+	// preferred one doesn't connect within FallbackDelay, which defaults to
+	// 300ms. Over UDP, it's only used when the host name has no address of
+	// the preferred family. Defaults to the order of the system resolver.
+	PreferredAddressFamily string        `json:"preferred_address_family,omitempty"`
+	FallbackDelay          time.Duration `json:"fallback_delay,omitempty"`
+
+	// Timeouts for establishing connections, and for reading and writing
+	// messages. Default to 5s, 10s and 5s respectively.
+	DialTimeout  time.Duration `json:"dial_timeout,omitempty"`
+	ReadTimeout  time.Duration `json:"read_timeout,omitempty"`
+	WriteTimeout time.Duration `json:"write_timeout,omitempty"`
+
+	// Keep a copy of the zone records after listing them, and use
+	// incremental zone transfers (IXFR) to only fetch the changes on the next
+	// calls. Servers which don't support IXFR fall back to a full transfer.
+	IXFR bool `json:"ixfr,omitempty"`
+
+	// Reuse the records listed by GetRecords for this duration without
+	// contacting the server. After that, they are reused as long as the
+	// SOA serial of the zone doesn't change. Changes made through the
+	// provider clear the cache. Defaults to no caching.
+	CacheTTL time.Duration `json:"cache_ttl,omitempty"`
+
+	// TTL of the records added without one. Defaults to sending a TTL of 0.
+	DefaultTTL time.Duration `json:"default_ttl,omitempty"`
+
+	// Bounds on the TTL of the records added, which are raised or lowered to
+	// fit. Default to no bounds.
+	MinTTL time.Duration `json:"min_ttl,omitempty"`
+	MaxTTL time.Duration `json:"max_ttl,omitempty"`
+
+	// Leave out the records maintained by DNSSEC signers from the records
+	// listed by GetRecords: DNSKEY, RRSIG, NSEC, NSEC3 and NSEC3PARAM.
+	ExcludeDNSSEC bool `json:"exclude_dnssec,omitempty"`
+
+	// Which SOA and NS records are listed by GetRecords and Records:
+	// "include" lists them all, "exclude" leaves them all out, and
+	// "exclude-apex" only leaves out the SOA and NS records at the zone
+	// apex, which are usually managed along with the server, while keeping
+	// the NS records of delegations. The SOA record closing zone transfers is
+	// never listed. Defaults to "include".
+	SOANSRecords string `json:"soa_ns_records,omitempty"`
+
+	// Master zone files read to list the records of zones, instead of zone
+	// transfers, indexed by zone name, for servers which block transfers but
+	// whose files are accessible, for instance on the same host. Updates are
+	// still sent to the server, so the files must be kept up to date by the
+	// server: BIND only writes updates to its journal until "rndc sync", and
+	// Knot must be configured with "zonefile-sync: 0".
+	ZoneFiles map[string]string `json:"zone_files,omitempty"`
+
+	// Names, relative to the zone, looked up with ordinary queries to list
+	// records when the server refuses zone transfers. Use "@" for the zone
+	// apex. Only records of these names are then returned.
+	LookupNames []string `json:"lookup_names,omitempty"`
+
+	// Record types looked up for each of the names above. Defaults to A,
+	// AAAA, CAA, CNAME, MX, NS, SRV and TXT.
+	LookupTypes []string `json:"lookup_types,omitempty"`
+
+	// Local address to listen on for NOTIFY messages sent by the primary
+	// server when a zone changes, such as ":53". Required by Watch.
+	NotifyAddr string `json:"notify_addr,omitempty"`
+
+	// Fetch the records of a zone when Watch reports a change. Combined with
+	// IXFR, only the changes are transferred.
+	WatchRecords bool `json:"watch_records,omitempty"`
+
+	// Maximum number of attempts for queries failing with a transient error,
+	// such as a timeout, a connection reset or SERVFAIL. Defaults to 3.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+
+	// Delay before the first retry, doubled after each attempt and randomized
+	// with jitter. Defaults to 500ms.
+	RetryBackoff time.Duration `json:"retry_backoff,omitempty"`
+
+	// Maximum number of messages sent per second to each server. Defaults
+	// to no limit.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+
+	// Number of consecutive failures showing that a server is unavailable,
+	// such as timeouts or SERVFAIL, after which the server is skipped: its
+	// circuit is open, and messages fail fast with ErrCircuitOpen, except
+	// for a probe every CircuitBreakerCooldown which closes the circuit if
+	// it succeeds. Defaults to no circuit breaker.
+	CircuitBreakerThreshold int `json:"circuit_breaker_threshold,omitempty"`
+
+	// Time before a server with an open circuit is probed again. Defaults to
+	// 30s.
+	CircuitBreakerCooldown time.Duration `json:"circuit_breaker_cooldown,omitempty"`
+
+	// Custom function used to establish connections to DNS servers, for
+	// instance to route traffic through a tunnel. Defaults to net.Dialer.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error) `json:"-"`
+
+	// Transport used for DNS-over-QUIC servers, such as doq.Transport from
+	// the github.com/libdns/dnsupdate/doq module. Messages to "quic://"
+	// addresses fail without it.
+	QUICTransport QUICTransport `json:"-"`
+
+	// Logger receiving a debug message for each exchange with a server, or
+	// an info message when the exchange fails. Defaults to no logging.
+	Logger *slog.Logger `json:"-"`
+
+	// Tracer provider used to record a span for each operation and each
+	// exchange with a server. Defaults to no tracing.
+	TracerProvider trace.TracerProvider `json:"-"`
+
+	// Prometheus collectors updated after each exchange with a server.
+	// Defaults to no metrics.
+	Metrics *Metrics `json:"-"`
+
+	// Writer receiving every message sent to and received from servers, in
+	// text form, to debug exchanges. Note that the signatures and cookies
+	// added by the transport aren't included in sent messages.
+	DumpWriter io.Writer `json:"-"`
+
+	// Write messages to DumpWriter as hexadecimal wire format instead of
+	// text.
+	DumpHex bool `json:"dump_hex,omitempty"`
+
+	// Middleware wrapping the exchanges with servers, the first one being
+	// the outermost.
+	Middleware []Middleware `json:"-"`
+
+	// Make SetRecords fetch the current records of the zone first, and only
+	// send the records to remove and to add instead of replacing whole
+	// RRsets. This avoids needless changes to the zone.
+	SetRecordsDiff bool `json:"set_records_diff,omitempty"`
+
+	// Make SetRecords keep the TTL of existing RRsets for the records given
+	// without a TTL, instead of replacing it. This takes precedence over
+	// DefaultTTL.
+	SetRecordsKeepTTL bool `json:"set_records_keep_ttl,omitempty"`
+
+	// Maximum size of update messages, not counting signatures and EDNS0
+	// options. Larger updates are split into several messages, keeping the
+	// changes to each RRset together, so they are no longer applied
+	// atomically as a whole. Defaults to 64 KiB minus some room for
+	// signatures.
+	MaxMessageSize int `json:"max_message_size,omitempty"`
+
+	// Allow operations deleting whole zones, such as ClearZone.
+	AllowDestructive bool `json:"allow_destructive,omitempty"`
+
+	// Names which the provider may change, so that a leaked configuration
+	// meant for ACME challenges can't be used to change other records. Each
+	// pattern is an absolute domain name, such as "dyn.example.org", which
+	// allows the name and its subdomains, and where a "*" label matches one
+	// or more labels, as in "_acme-challenge.*". Updates changing other
+	// names fail with ErrOutOfScope. Defaults to allowing all names.
+	Scope []string `json:"scope,omitempty"`
+
+	// Records which updates may not delete or replace, to protect against
+	// callers passing a whole zone to DeleteRecords. Each pattern is a name
+	// relative to the zone, "@" for the zone apex, and a record type, either
+	// being "*" to match any, such as "@ SOA", "@ NS" or "* MX". Updates
+	// changing them fail with ErrProtected, unless the operation is made
+	// with a context returned by WithProtectedChanges. Adding records is
+	// still allowed.
+	ProtectedRecords []string `json:"protected_records,omitempty"`
+
+	// Maximum number of records which a single operation may delete in a
+	// zone, either a count such as "10" or a percentage of the records of
+	// the zone such as "5%", as a last guard against automation bugs wiping
+	// zones. With AutoZone, the limit applies to each zone separately.
+	// Operations deleting more records fail with ErrTooManyDeletes, before
+	// any update is sent. The zone is transferred to count the records
+	// deleted. Defaults to no limit.
+	MaxDeletes string `json:"max_deletes,omitempty"`
+
+	// Build update messages without sending them, to preview changes. The
+	// records which would be changed are still returned.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Function called with each update message built in dry-run mode.
+	// Defaults to printing the message to the standard error.
+	DryRunFunc func(msg *dns.Msg) `json:"-"`
+
+	// Function called with the changes of each operation deleting records,
+	// once before any of its update messages is sent, to implement approval
+	// workflows or policy engines. Returning an error aborts the whole
+	// operation. It isn't called in dry-run mode.
+	ConfirmFunc func(ctx context.Context, changes ChangeSet) error `json:"-"`
+
+	// Also maintain the PTR records of the addresses of the A and AAAA
+	// records added, set or deleted, in the in-addr.arpa and ip6.arpa zones
+	// found with FindZone. Added addresses get a PTR record replacing any
+	// other, and the PTR records of removed addresses are deleted if they
+	// point to the same name. PTR records are updated after the records
+	// themselves.
+	ManagePTR bool `json:"manage_ptr,omitempty"`
+
+	// Provider used to update PTR records, when the reverse zones are hosted
+	// on other servers or need other keys. Defaults to this provider.
+	PTRProvider *Provider `json:"ptr_provider,omitempty"`
+
+	// Detect the zone of each record in updates by walking up its name with
+	// SOA queries, see FindZone, so that records below a zone cut are
+	// updated in their own zone. For instance, "www.sub" in zone
+	// "example.org." is then updated in zone "sub.example.org." if it
+	// exists. Records are still named relative to the given zone.
+	AutoZone bool `json:"auto_zone,omitempty"`
+
+	// Check that the server is authoritative for the zone before sending
+	// updates, with a SOA query, to report mistyped zones with
+	// ErrZoneNotHosted rather than with NOTZONE or NOTAUTH errors.
+	CheckZone bool `json:"check_zone,omitempty"`
+
+	// Query the records added or set after each update, and fail with
+	// ErrNotServed if the server doesn't serve them, since some servers
+	// silently ignore changes denied by their update policy.
+	VerifyWrites bool `json:"verify_writes,omitempty"`
+
+	// Queue updates which fail because the servers are unreachable, and
+	// send them again every QueueRetryInterval until they succeed, for
+	// devices with unreliable network links. The operations then succeed
+	// without waiting for the updates. Later updates are queued behind them,
+	// so that updates are applied in order, and updates failing for another
+	// reason when sent again are dropped. At most QueueSize updates are
+	// queued, further ones fail with ErrQueueFull. Updates made with a
+	// context returned by WithServer, WithKey, WithView or WithTimeout
+	// aren't queued, and fail as usual. The records of queued updates aren't
+	// checked with VerifyWrites, and their PTR records aren't managed.
+	QueueUpdates bool `json:"queue_updates,omitempty"`
+
+	// Maximum number of queued updates, and interval between attempts to
+	// send them. Default to 100 and 30s respectively.
+	QueueSize          int           `json:"queue_size,omitempty"`
+	QueueRetryInterval time.Duration `json:"queue_retry_interval,omitempty"`
+
+	// File where queued updates are saved, so that they survive restarts.
+	// They are loaded with the first update, or with FlushQueue.
+	QueueFile string `json:"queue_file,omitempty"`
+
+	// Check that the SOA serial of the zone increased after each update
+	// message, to make sure the changes were applied before going on. Note
+	// that updates which leave the zone unchanged, such as deleting missing
+	// records, then fail.
+	VerifySerial bool `json:"verify_serial,omitempty"`
+
+	// Time to wait for the SOA serial to increase, and interval between SOA
+	// queries. Default to 10s and 1s respectively.
+	VerifySerialTimeout  time.Duration `json:"verify_serial_timeout,omitempty"`
+	VerifySerialInterval time.Duration `json:"verify_serial_interval,omitempty"`
+
+	mu   sync.Mutex
+	http *http.Client
+	idle map[string][]idleConn
+
+	limiters map[string]*rate.Limiter
+
+	circuits map[string]*circuit
+
+	queue *updateQueue
+
+	gssContexts map[string]*gssContext
+
+	primaries map[string]*primaryServer
+
+	snapshots map[string]*zoneSnapshot
+
+	notify *notifyListener
+
+	cookies map[string]dnsCookie
+
+	zoneLocks map[string]chan struct{}
+
+	cache map[string]*cachedZone
+
+	clockOffsets map[string]int64
 }
 
-func (p *Provider) roundTrip(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
-	client := dns.Client{Net: "tcp"}
-	reply, _, err := client.ExchangeContext(ctx, query, p.Addr)
+// GetRecords lists all the records in the zone. If the server refuses zone
+// transfers and LookupNames is set, only the records of these names are listed.
+func (p *Provider) GetRecords(ctx context.Context, zone string) (_ []libdns.Record, err error) {
+	ctx, span := p.startSpan(ctx, "GetRecords", zone)
+	defer func() { endSpan(span, err) }()
+
+	zone, err = p.resolveZone(zone)
 	if err != nil {
 		return nil, err
-	} else if reply.Rcode != dns.RcodeSuccess {
-		return nil, fmt.Errorf("DNS error: %v", dns.RcodeToString[reply.Rcode])
 	}
-	return reply, nil
-}
 
-// GetRecords lists all the records in the zone.
-func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
-	var query dns.Msg
-	query.SetAxfr(zone)
+	cache := p.CacheTTL > 0 && callOptionsFrom(ctx).view == ""
+	if cache {
+		if records, ok := p.cachedRecords(ctx, zone); ok {
+			return records, nil
+		}
+	}
+
+	rrs, err := p.transferZone(ctx, zone)
+	if isNotAuthoritative(err) && len(p.LookupNames) > 0 {
+		rrs, err = p.lookupRecords(ctx, zone)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	reply, err := p.roundTrip(ctx, &query)
+	excluded, err := p.excludedRR(zone)
 	if err != nil {
 		return nil, err
 	}
 
-	return unmarshalRecords(zone, reply.Answer), nil
+	records := unmarshalRecords(zone, dedupRRs(slices.DeleteFunc(slices.Clone(rrs), excluded)))
+	if cache {
+		if serial, err := p.zoneSerial(ctx, zone, rrs); err == nil {
+			p.cacheRecords(zone, serial, records)
+		}
+	}
+	return records, nil
 }
 
 // AppendRecords adds records to the zone. It returns the records that were added.
-func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) (_ []libdns.Record, err error) {
+	ctx, span := p.startSpan(ctx, "AppendRecords", zone)
+	defer func() { endSpan(span, err) }()
+
+	zone, err = p.resolveZone(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	rrs, err := marshalRecords(zone, records)
 	if err != nil {
 		return nil, err
 	}
+	rrs = dedupRRs(rrs)
+	p.applyTTLs(rrs)
 
 	var query dns.Msg
 	query.SetUpdate(zone)
 	query.Insert(rrs)
 
-	if _, err := p.roundTrip(ctx, &query); err != nil {
+	if err := p.update(ctx, &query); errors.Is(err, errQueued) {
+		// The update can't be checked before it's sent
+		return unmarshalSentRecords(zone, rrs), nil
+	} else if err != nil {
 		return nil, err
 	}
+	if p.VerifyWrites && !p.DryRun {
+		if err := p.verifyServed(ctx, rrs); err != nil {
+			return nil, err
+		}
+	}
+	if p.ManagePTR {
+		if err := p.updatePTRs(ctx, rrs, nil); err != nil {
+			return nil, err
+		}
+	}
 
-	return unmarshalRecords(zone, rrs), nil
+	return unmarshalSentRecords(zone, rrs), nil
 }
 
 // SetRecords sets the records in the zone, either by updating existing records or creating new ones.
+// Existing records with the same name and type as one of the input records are replaced.
 // It returns the updated records.
-func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	insertRRs, err := marshalRecords(zone, records)
+func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) (_ []libdns.Record, err error) {
+	ctx, span := p.startSpan(ctx, "SetRecords", zone)
+	defer func() { endSpan(span, err) }()
+
+	zone, err = p.resolveZone(zone)
 	if err != nil {
 		return nil, err
 	}
 
-	// Build a set of RRs that are new
-	m := make(map[string]struct{})
-	for _, rr := range insertRRs {
-		m[rr.String()] = struct{}{}
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return nil, err
 	}
+	defer unlock()
 
-	// Remove old RRs that aren't in the set of new RRs
-	var removeRRs []dns.RR
-	for _, record := range records {
-		if record.ID == "" {
-			continue
-		}
-		if _, ok := m[record.ID]; ok {
-			continue
+	insertRRs, err := marshalRecords(zone, records)
+	if err != nil {
+		return nil, err
+	}
+	insertRRs = dedupRRs(insertRRs)
+	if p.SetRecordsKeepTTL {
+		if err := p.keepTTLs(ctx, zone, insertRRs); err != nil {
+			return nil, err
 		}
+	}
+	p.applyTTLs(insertRRs)
 
-		rr, err := parseRecordID(record.ID)
+	var oldAddrs []dns.RR
+	if p.ManagePTR {
+		oldAddrs, err = p.currentAddrs(ctx, insertRRs)
 		if err != nil {
 			return nil, err
 		}
-
-		removeRRs = append(removeRRs, rr)
 	}
 
 	var query dns.Msg
 	query.SetUpdate(zone)
-	query.Insert(insertRRs)
-	query.Remove(removeRRs)
+	if p.SetRecordsDiff {
+		removeRRs, addRRs, err := p.diffRRsets(ctx, zone, insertRRs)
+		if err != nil {
+			return nil, err
+		} else if len(removeRRs) == 0 && len(addRRs) == 0 {
+			return unmarshalSentRecords(zone, insertRRs), nil
+		}
+		query.Remove(removeRRs)
+		query.Insert(addRRs)
+	} else {
+		// Delete each RRset once, in the same message as the insertions so
+		// that the replacement is atomic
+		seen := make(map[rrsetKey]struct{})
+		var removeRRsets []dns.RR
+		for _, rr := range insertRRs {
+			key := rrsetKeyOf(rr)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			removeRRsets = append(removeRRsets, rr)
+		}
+		query.RemoveRRset(removeRRsets)
+		query.Insert(insertRRs)
+	}
 
-	if _, err := p.roundTrip(ctx, &query); err != nil {
+	if err := p.update(ctx, &query); errors.Is(err, errQueued) {
+		return unmarshalSentRecords(zone, insertRRs), nil
+	} else if err != nil {
 		return nil, err
 	}
+	if p.VerifyWrites && !p.DryRun {
+		if err := p.verifyServed(ctx, insertRRs); err != nil {
+			return nil, err
+		}
+	}
+	if p.ManagePTR {
+		if err := p.updatePTRs(ctx, insertRRs, oldAddrs); err != nil {
+			return nil, err
+		}
+	}
 
-	return unmarshalRecords(zone, insertRRs), nil
+	return unmarshalSentRecords(zone, insertRRs), nil
 }
 
 // DeleteRecords deletes the records from the zone. It returns the records that were deleted.
-func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	rrs := make([]dns.RR, len(records))
-	for i, record := range records {
-		// If a record ID was supplied, use that. Otherwise, generate a RR
-		// from the record data fields.
-		var (
-			rr  dns.RR
-			err error
-		)
-		if record.ID != "" {
-			rr, err = parseRecordID(record.ID)
-		} else {
-			rr, err = marshalRecord(zone, &record)
-		}
-		if err != nil {
-			return nil, err
-		}
-		rrs[i] = rr
+// A record without data, such as a libdns.RR with only a name and a type,
+// deletes the whole RRset of its name and type, and a record without type
+// deletes all the records of its name. Such records are returned as generic
+// libdns.RR records without data. Duplicate records are only deleted once.
+// A record holding a record ID as ProviderData, as returned by the other
+// methods, deletes the record of the zone with this ID, even if its fields
+// were changed since.
+func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) (_ []libdns.Record, err error) {
+	ctx, span := p.startSpan(ctx, "DeleteRecords", zone)
+	defer func() { endSpan(span, err) }()
+
+	zone, err = p.resolveZone(zone)
+	if err != nil {
+		return nil, err
 	}
 
-	rrs, err := marshalRecords(zone, records)
+	unlock, err := p.lockZone(ctx, zone)
 	if err != nil {
 		return nil, err
 	}
+	defer unlock()
+
+	rrs, err := marshalDeletions(zone, records)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.resolveRecordIDs(ctx, zone, records, rrs); err != nil {
+		return nil, err
+	}
+	rrs = dedupRRs(rrs)
+
+	var removedAddrs []dns.RR
+	if p.ManagePTR {
+		removedAddrs, err = p.deletedAddrs(ctx, rrs)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	var query dns.Msg
 	query.SetUpdate(zone)
-	query.Remove(rrs)
+	query.Ns = rrs
 
-	if _, err := p.roundTrip(ctx, &query); err != nil {
+	if err := p.update(ctx, &query); errors.Is(err, errQueued) {
+		return unmarshalSentRecords(zone, rrs), nil
+	} else if err != nil {
 		return nil, err
 	}
+	if p.ManagePTR {
+		if err := p.updatePTRs(ctx, nil, removedAddrs); err != nil {
+			return nil, err
+		}
+	}
 
-	return unmarshalRecords(zone, rrs), err
+	return unmarshalSentRecords(zone, rrs), nil
 }
 
 // Interface guards
@@ -152,48 +702,244 @@ var (
 func marshalRecords(zone string, records []libdns.Record) ([]dns.RR, error) {
 	rrs := make([]dns.RR, 0, len(records))
 	for _, record := range records {
-		rr, err := marshalRecord(zone, &record)
+		rr, err := marshalRecord(zone, record)
 		if err != nil {
-			return nil, err
+			r := record.RR()
+			return nil, fmt.Errorf("invalid %v record %q: %w", r.Type, r.Name, err)
 		}
 		rrs = append(rrs, rr)
 	}
 	return rrs, nil
 }
 
-func marshalRecord(zone string, record *libdns.Record) (dns.RR, error) {
-	fqdn := libdns.AbsoluteName(record.Name, zone)
-	ttl := uint32(record.TTL / time.Second)
-	raw := fmt.Sprintf("%v %v IN %v %v", fqdn, ttl, record.Type, record.Value)
+// marshalDeletions returns the RRs of an update deleting the records. A
+// record without data deletes the RRset of its name and type, and a record
+// without type deletes all the RRsets of its name (RFC 2136 section 2.5).
+func marshalDeletions(zone string, records []libdns.Record) ([]dns.RR, error) {
+	rrs := make([]dns.RR, 0, len(records))
+	for _, record := range records {
+		r := record.RR()
+		if r.Type != "" && r.Data != "" {
+			rr, err := marshalRecord(zone, record)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %v record %q: %w", r.Type, r.Name, err)
+			}
+			rr.Header().Class = dns.ClassNONE
+			rr.Header().Ttl = 0
+			rrs = append(rrs, rr)
+			continue
+		}
+
+		fqdn, err := toASCII(libdns.AbsoluteName(r.Name, zone))
+		if err != nil {
+			return nil, err
+		}
+		rtype := uint16(dns.TypeANY)
+		if r.Type != "" {
+			var ok bool
+			if rtype, ok = dns.StringToType[r.Type]; !ok {
+				return nil, fmt.Errorf("unknown record type %q", r.Type)
+			}
+		}
+		rrs = append(rrs, &dns.ANY{Hdr: dns.RR_Header{Name: fqdn, Rrtype: rtype, Class: dns.ClassANY}})
+	}
+	return rrs, nil
+}
+
+// marshalRRsets returns RRs identifying the RRsets of the records, with only
+// their name and type set.
+func marshalRRsets(zone string, records []libdns.Record) ([]dns.RR, error) {
+	rrs := make([]dns.RR, 0, len(records))
+	for _, record := range records {
+		r := record.RR()
+		fqdn, err := toASCII(libdns.AbsoluteName(r.Name, zone))
+		if err != nil {
+			return nil, err
+		}
+		rtype, ok := dns.StringToType[r.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown record type %q", r.Type)
+		}
+		rrs = append(rrs, &dns.ANY{Hdr: dns.RR_Header{Name: fqdn, Rrtype: rtype}})
+	}
+	return rrs, nil
+}
+
+func marshalRecord(zone string, record libdns.Record) (dns.RR, error) {
+	// Generic records hold data in the unescaped format defined by libdns,
+	// so they are handled like records of the specific type
+	if r, ok := record.(libdns.RR); ok {
+		if parsed, err := r.Parse(); err == nil {
+			record = parsed
+		}
+	}
+
+	r := record.RR()
+	fqdn, err := toASCII(libdns.AbsoluteName(r.Name, zone))
+	if err != nil {
+		return nil, err
+	}
+	if err := validateRecord(fqdn, r); err != nil {
+		return nil, err
+	}
+
+	switch record := record.(type) {
+	case libdns.ServiceBinding:
+		return marshalServiceBinding(fqdn, record)
+	case libdns.CAA:
+		return marshalCAA(fqdn, record), nil
+	case libdns.TXT:
+		return marshalTXT(fqdn, record), nil
+	}
+
+	ttl := uint32(r.TTL / time.Second)
+	raw := fmt.Sprintf("%v %v IN %v %v", fqdn, ttl, r.Type, r.Data)
 	return dns.NewRR(raw)
 }
 
 func unmarshalRecords(zone string, rrs []dns.RR) []libdns.Record {
 	records := make([]libdns.Record, 0, len(rrs))
 	for _, rr := range rrs {
-		hdr := rr.Header()
-		records = append(records, libdns.Record{
-			ID:    formatRecordID(rr, zone),
-			Type:  dns.Type(hdr.Rrtype).String(),
-			Name:  hdr.Name,
-			Value: strings.TrimPrefix(rr.String(), hdr.String()),
-			TTL:   time.Duration(hdr.Ttl) * time.Second,
-		})
+		records = append(records, unmarshalRecord(zone, rr))
+	}
+	return records
+}
+
+// unmarshalSentRecords converts the RRs built by marshalRecords to records.
+// They are packed and unpacked first, so that the values match those returned
+// by GetRecords.
+func unmarshalSentRecords(zone string, rrs []dns.RR) []libdns.Record {
+	records := make([]libdns.Record, 0, len(rrs))
+	buf := make([]byte, dns.MaxMsgSize)
+	for _, rr := range rrs {
+		// RRs deleting RRsets or names have no data
+		if hdr := rr.Header(); hdr.Class == dns.ClassANY {
+			record := libdns.RR{Name: toUnicode(relativeName(hdr.Name, zone))}
+			if hdr.Rrtype != dns.TypeANY {
+				record.Type = dns.TypeToString[hdr.Rrtype]
+			}
+			records = append(records, record)
+			continue
+		}
+
+		if n, err := dns.PackRR(rr, buf, 0, nil, false); err == nil {
+			if unpacked, _, err := dns.UnpackRR(buf[:n], 0); err == nil {
+				rr = unpacked
+			}
+		}
+		records = append(records, unmarshalRecord(zone, rr))
 	}
 	return records
 }
 
-func formatRecordID(rr dns.RR, zone string) string {
-	// We use the zone file representation of the record (with FQDN) as ID
-	rr = dns.Copy(rr)
-	rr.Header().Name = libdns.AbsoluteName(rr.Header().Name, zone)
-	return rr.String()
+// unmarshalRecord converts a RR to the libdns type matching its type, with
+// its record ID as ProviderData, or to a generic libdns.RR for other types.
+// The name of the record is made relative to the zone.
+func unmarshalRecord(zone string, rr dns.RR) libdns.Record {
+	id, err := rrID(rr)
+	if err != nil {
+		id = ""
+	}
+	return withRecordID(unmarshalRecordData(zone, rr), id)
 }
 
-func parseRecordID(id string) (dns.RR, error) {
-	rr, err := dns.NewRR(id)
+// unmarshalRecordData converts a RR to a record, without its record ID.
+func unmarshalRecordData(zone string, rr dns.RR) libdns.Record {
+	if name := toUnicode(relativeName(rr.Header().Name, zone)); name != rr.Header().Name {
+		rr = dns.Copy(rr)
+		rr.Header().Name = name
+	}
+
+	var svcb *dns.SVCB
+	switch rr := rr.(type) {
+	case *dns.SVCB:
+		svcb = rr
+	case *dns.HTTPS:
+		svcb = &rr.SVCB
+	case *dns.CAA:
+		return unmarshalCAA(rr)
+	case *dns.TXT:
+		return unmarshalTXT(rr)
+	}
+	if svcb != nil {
+		if record, err := unmarshalServiceBinding(rr, svcb); err == nil {
+			return record
+		}
+	}
+
+	hdr := rr.Header()
+	r := libdns.RR{
+		Type: dns.Type(hdr.Rrtype).String(),
+		Name: hdr.Name,
+		Data: recordData(rr),
+		TTL:  time.Duration(hdr.Ttl) * time.Second,
+	}
+
+	record, err := r.Parse()
 	if err != nil {
-		return nil, fmt.Errorf("invalid record ID (%v)", err)
+		return r
+	}
+	return record
+}
+
+// excludedRR returns a function reporting whether a RR of the zone is left
+// out of the records listed, according to ExcludeDNSSEC and SOANSRecords.
+func (p *Provider) excludedRR(zone string) (func(rr dns.RR) bool, error) {
+	var excludeSOANS func(hdr *dns.RR_Header) bool
+	switch p.SOANSRecords {
+	case "", "include":
+		excludeSOANS = func(*dns.RR_Header) bool { return false }
+	case "exclude":
+		excludeSOANS = func(*dns.RR_Header) bool { return true }
+	case "exclude-apex":
+		excludeSOANS = func(hdr *dns.RR_Header) bool {
+			return dns.CanonicalName(hdr.Name) == dns.CanonicalName(zone)
+		}
+	default:
+		return nil, fmt.Errorf("invalid SOA and NS records policy %q, expected include, exclude or exclude-apex", p.SOANSRecords)
+	}
+
+	return func(rr dns.RR) bool {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeSOA || hdr.Rrtype == dns.TypeNS {
+			return excludeSOANS(hdr)
+		}
+		return p.ExcludeDNSSEC && isDNSSECRR(rr)
+	}, nil
+}
+
+// isDNSSECRR returns true if a RR is maintained by DNSSEC signers.
+func isDNSSECRR(rr dns.RR) bool {
+	switch rr.Header().Rrtype {
+	case dns.TypeDNSKEY, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM:
+		return true
+	default:
+		return false
+	}
+}
+
+// relativeName returns a name relative to the zone, or "@" for the zone
+// itself. Names outside of the zone are returned as is.
+func relativeName(name, zone string) string {
+	if !dns.IsSubDomain(zone, name) {
+		return name
+	}
+
+	labels := dns.SplitDomainName(name)
+	labels = labels[:len(labels)-dns.CountLabel(zone)]
+	if len(labels) == 0 {
+		return "@"
+	}
+	return strings.Join(labels, ".")
+}
+
+// recordData returns the data of a RR in presentation format.
+func recordData(rr dns.RR) string {
+	if rr, ok := rr.(*dns.RFC3597); ok {
+		// Records of unknown types use the generic syntax defined in RFC 3597
+		// section 5. Their String method doesn't format the header like for
+		// other types, so the data can't be extracted from it.
+		return strings.TrimSpace(fmt.Sprintf(`\# %d %v`, len(rr.Rdata)/2, rr.Rdata))
 	}
-	return rr, nil
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
 }
@@ -0,0 +1,176 @@
+package dnsupdate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/libdns/dnsupdate"
+	"github.com/libdns/dnsupdate/dnsupdatetest"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+const testZone = "example.org."
+
+// newTestServer starts a server for testZone accepting messages signed with
+// a TSIG key, and returns it with a provider sending messages to it.
+func newTestServer(t *testing.T) (*dnsupdatetest.Server, *dnsupdate.Provider) {
+	t.Helper()
+	srv := dnsupdatetest.NewServerTSIG("key.", "c2VjcmV0c2VjcmV0", testZone)
+	t.Cleanup(srv.Close)
+	return srv, srv.Provider()
+}
+
+// txtRecords returns n TXT records with distinct names.
+func txtRecords(n int) []libdns.Record {
+	recs := make([]libdns.Record, n)
+	for i := range recs {
+		recs[i] = libdns.TXT{Name: fmt.Sprintf("h%d", i), TTL: time.Minute, Text: "x"}
+	}
+	return recs
+}
+
+// serverRecords returns the records of the zone held by the server, in the
+// presentation format, without the SOA and NS records.
+func serverRecords(srv *dnsupdatetest.Server) []string {
+	var rrs []string
+	for _, rr := range srv.Records(testZone) {
+		if rr.Header().Rrtype != dns.TypeSOA && rr.Header().Rrtype != dns.TypeNS {
+			rrs = append(rrs, rr.String())
+		}
+	}
+	slices.Sort(rrs)
+	return rrs
+}
+
+func TestAppendRecords(t *testing.T) {
+	srv, p := newTestServer(t)
+	ctx := context.Background()
+
+	recs := []libdns.Record{
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.TXT{Name: "www", TTL: time.Hour, Text: `v="1"`},
+	}
+	added, err := p.AppendRecords(ctx, testZone, recs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != len(recs) {
+		t.Fatalf("AppendRecords returned %d records, want %d", len(added), len(recs))
+	}
+
+	want := []string{
+		"www.example.org.\t3600\tIN\tA\t192.0.2.1",
+		"www.example.org.\t3600\tIN\tTXT\t\"v=\\\"1\\\"\"",
+	}
+	if got := serverRecords(srv); !slices.Equal(got, want) {
+		t.Errorf("server records = %q, want %q", got, want)
+	}
+}
+
+func TestSetRecords(t *testing.T) {
+	srv, p := newTestServer(t)
+	ctx := context.Background()
+
+	if _, err := p.AppendRecords(ctx, testZone, []libdns.Record{
+		libdns.TXT{Name: "a", TTL: time.Minute, Text: "old"},
+		libdns.TXT{Name: "b", TTL: time.Minute, Text: "kept"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SetRecords(ctx, testZone, []libdns.Record{
+		libdns.TXT{Name: "a", TTL: time.Minute, Text: "new"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"a.example.org.\t60\tIN\tTXT\t\"new\"",
+		"b.example.org.\t60\tIN\tTXT\t\"kept\"",
+	}
+	if got := serverRecords(srv); !slices.Equal(got, want) {
+		t.Errorf("server records = %q, want %q", got, want)
+	}
+}
+
+func TestDeleteRecords(t *testing.T) {
+	srv, p := newTestServer(t)
+	ctx := context.Background()
+
+	if _, err := p.AppendRecords(ctx, testZone, txtRecords(3)); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := p.DeleteRecords(ctx, testZone, []libdns.Record{
+		libdns.TXT{Name: "h0", Text: "x"},
+		libdns.RR{Name: "h1", Type: "TXT"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 2 {
+		t.Errorf("DeleteRecords returned %d records, want 2", len(deleted))
+	}
+
+	want := []string{"h2.example.org.\t60\tIN\tTXT\t\"x\""}
+	if got := serverRecords(srv); !slices.Equal(got, want) {
+		t.Errorf("server records = %q, want %q", got, want)
+	}
+}
+
+func TestGetRecords(t *testing.T) {
+	_, p := newTestServer(t)
+	ctx := context.Background()
+
+	// Enough records for the transfer to span several messages, each of
+	// them signed
+	recs := txtRecords(1200)
+	if _, err := p.AppendRecords(ctx, testZone, recs); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := p.GetRecords(ctx, testZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The SOA and NS records are listed too
+	if len(got) != len(recs)+2 {
+		t.Fatalf("GetRecords returned %d records, want %d", len(got), len(recs)+2)
+	}
+	names := make(map[string]bool)
+	for _, rec := range got {
+		names[rec.RR().Name] = true
+	}
+	for _, rec := range recs {
+		if !names[rec.RR().Name] {
+			t.Errorf("record %v not listed", rec.RR().Name)
+		}
+	}
+}
+
+func TestGetRecordsNotAuth(t *testing.T) {
+	_, p := newTestServer(t)
+
+	_, err := p.GetRecords(context.Background(), "other.org.")
+	var rerr dnsupdate.RcodeError
+	if !errors.As(err, &rerr) || rerr != dns.RcodeNotAuth {
+		t.Errorf("GetRecords error = %v, want NOTAUTH", err)
+	}
+}
+
+func TestBadKey(t *testing.T) {
+	srv, _ := newTestServer(t)
+	p := srv.Provider()
+	p.TSIGSecret = "b3RoZXJvdGhlcg=="
+
+	if _, err := p.AppendRecords(context.Background(), testZone, txtRecords(1)); err == nil {
+		t.Fatal("AppendRecords succeeded with the wrong TSIG secret")
+	}
+	if got := serverRecords(srv); len(got) != 0 {
+		t.Errorf("server records = %q, want none", got)
+	}
+}
@@ -0,0 +1,160 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// ptrProvider returns the provider used to update PTR records.
+func (p *Provider) ptrProvider() *Provider {
+	if p.PTRProvider != nil {
+		return p.PTRProvider
+	}
+	return p
+}
+
+// updatePTRs updates the PTR records matching A and AAAA records: added
+// records get a PTR record replacing any other for their address, and the
+// PTR records of removed records are deleted if they point to their name.
+// The reverse zones are found with FindZone.
+func (p *Provider) updatePTRs(ctx context.Context, added, removed []dns.RR) error {
+	ptr := p.ptrProvider()
+
+	var (
+		zones []string
+		msgs  = make(map[string]*dns.Msg)
+	)
+	zoneMsg := func(reverse string) (*dns.Msg, error) {
+		zone, err := ptr.findZone(ctx, reverse, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to find reverse zone of %v: %w", reverse, err)
+		}
+		msg, ok := msgs[zone]
+		if !ok {
+			msg = new(dns.Msg)
+			msg.SetUpdate(zone)
+			msgs[zone] = msg
+			zones = append(zones, zone)
+		}
+		return msg, nil
+	}
+
+	for _, rr := range removed {
+		reverse, rec := ptrRecord(rr)
+		if rec == nil {
+			continue
+		}
+		msg, err := zoneMsg(reverse)
+		if err != nil {
+			return err
+		}
+		msg.Remove([]dns.RR{rec})
+	}
+	for _, rr := range added {
+		reverse, rec := ptrRecord(rr)
+		if rec == nil {
+			continue
+		}
+		msg, err := zoneMsg(reverse)
+		if err != nil {
+			return err
+		}
+		msg.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: reverse, Rrtype: dns.TypePTR}}})
+		msg.Insert([]dns.RR{rec})
+	}
+
+	for _, zone := range zones {
+		if err := ptr.sendAtomicUpdate(ctx, msgs[zone]); err != nil {
+			return fmt.Errorf("failed to update PTR records in %v: %w", zone, err)
+		}
+	}
+	return nil
+}
+
+// ptrRecord returns the PTR record matching an A or AAAA record, and its
+// owner name. The record is nil for other records, and for records without
+// an address.
+func ptrRecord(rr dns.RR) (string, *dns.PTR) {
+	var ip string
+	switch rr := rr.(type) {
+	case *dns.A:
+		if rr.A == nil {
+			return "", nil
+		}
+		ip = rr.A.String()
+	case *dns.AAAA:
+		if rr.AAAA == nil {
+			return "", nil
+		}
+		ip = rr.AAAA.String()
+	default:
+		return "", nil
+	}
+
+	reverse, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return "", nil
+	}
+	hdr := rr.Header()
+	return reverse, &dns.PTR{
+		Hdr: dns.RR_Header{Name: reverse, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: hdr.Ttl},
+		Ptr: hdr.Name,
+	}
+}
+
+// currentAddrs looks up the A and AAAA records of the RRsets about to be
+// replaced by the given records, so that the PTR records of the addresses
+// which go away can be deleted.
+func (p *Provider) currentAddrs(ctx context.Context, rrs []dns.RR) ([]dns.RR, error) {
+	seen := make(map[rrsetKey]struct{})
+	var current []dns.RR
+	for _, rr := range rrs {
+		key := rrsetKeyOf(rr)
+		if _, ok := seen[key]; ok || (key.rtype != dns.TypeA && key.rtype != dns.TypeAAAA) {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		rrset, err := p.lookupRRset(ctx, key.name, key.rtype)
+		if err != nil && !errors.Is(err, ErrNXDomain) {
+			return nil, err
+		}
+		current = append(current, rrset...)
+	}
+
+	// Addresses which are kept don't need their PTR records deleted
+	return slices.DeleteFunc(current, func(old dns.RR) bool {
+		return slices.ContainsFunc(rrs, func(rr dns.RR) bool {
+			return dns.IsDuplicate(old, rr)
+		})
+	}), nil
+}
+
+// deletedAddrs returns the A and AAAA records deleted by the RRs of an
+// update, looking up the records of deleted RRsets and names.
+func (p *Provider) deletedAddrs(ctx context.Context, rrs []dns.RR) ([]dns.RR, error) {
+	var addrs []dns.RR
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if hdr.Class != dns.ClassANY {
+			addrs = append(addrs, rr)
+			continue
+		}
+
+		for _, rtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			if hdr.Rrtype != rtype && hdr.Rrtype != dns.TypeANY {
+				continue
+			}
+			rrset, err := p.lookupRRset(ctx, hdr.Name, rtype)
+			if err != nil && !errors.Is(err, ErrNXDomain) {
+				return nil, err
+			}
+			addrs = append(addrs, rrset...)
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,287 @@
+package dnsupdate
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrQueueFull is returned when an update can't be sent and the queue of
+// updates waiting for the servers to be reachable is full.
+var ErrQueueFull = errors.New("update queue full")
+
+// errQueued is returned by sendUpdate when an update was queued instead of
+// sent, so that the steps checking its result are skipped. Operations
+// return it as a success.
+var errQueued = errors.New("update queued")
+
+// ignoreQueued returns nil if err only reports that an update was queued.
+func ignoreQueued(err error) error {
+	if errors.Is(err, errQueued) {
+		return nil
+	}
+	return err
+}
+
+const (
+	defaultQueueSize          = 100
+	defaultQueueRetryInterval = 30 * time.Second
+)
+
+func (p *Provider) queueSize() int {
+	if p.QueueSize > 0 {
+		return p.QueueSize
+	}
+	return defaultQueueSize
+}
+
+func (p *Provider) queueRetryInterval() time.Duration {
+	if p.QueueRetryInterval > 0 {
+		return p.QueueRetryInterval
+	}
+	return defaultQueueRetryInterval
+}
+
+// updateQueue holds the update messages waiting for the servers to be
+// reachable, in order.
+type updateQueue struct {
+	mu        sync.Mutex
+	loaded    bool
+	msgs      []*dns.Msg
+	replaying bool
+
+	// flushMu serializes the replays of the queue
+	flushMu sync.Mutex
+}
+
+// updateQueue returns the queue of the provider, loading the updates saved
+// in QueueFile the first time.
+func (p *Provider) updateQueue() (*updateQueue, error) {
+	p.mu.Lock()
+	if p.queue == nil {
+		p.queue = new(updateQueue)
+	}
+	q := p.queue
+	p.mu.Unlock()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.loaded && p.QueueFile != "" {
+		msgs, err := readQueueFile(p.QueueFile)
+		if err != nil {
+			return nil, err
+		}
+		q.msgs = msgs
+	}
+	q.loaded = true
+	return q, nil
+}
+
+// sendOrQueueUpdate sends an update message, or queues it to be sent later
+// if the servers are unreachable. Updates are also queued while earlier
+// updates are waiting, so that they are applied in order.
+//
+// Updates made with a context overriding the servers, key, view or timeout
+// aren't queued, since they are sent again without it.
+func (p *Provider) sendOrQueueUpdate(ctx context.Context, query *dns.Msg) error {
+	if callOptionsFrom(ctx).overridesExchanges() {
+		return p.deliverUpdate(ctx, query)
+	}
+
+	q, err := p.updateQueue()
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	empty := len(q.msgs) == 0
+	q.mu.Unlock()
+	if empty {
+		err = p.deliverUpdate(ctx, query)
+		if err == nil || ctx.Err() != nil || !isUnreachable(err) {
+			return err
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.msgs) >= p.queueSize() {
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrQueueFull, err)
+		}
+		return ErrQueueFull
+	}
+	q.msgs = append(q.msgs, query.Copy())
+	if err := p.saveQueue(q); err != nil {
+		q.msgs = q.msgs[:len(q.msgs)-1]
+		return err
+	}
+
+	if p.Logger != nil {
+		p.Logger.LogAttrs(ctx, slog.LevelInfo, "DNS update queued",
+			slog.String("zone", query.Question[0].Name),
+			slog.Int("queued", len(q.msgs)),
+		)
+	}
+	if !q.replaying {
+		q.replaying = true
+		go p.replayQueue(q)
+	}
+	return errQueued
+}
+
+// isUnreachable reports whether an update failing with err may succeed once
+// the servers are reachable again.
+func isUnreachable(err error) bool {
+	return isTransient(err) || errors.Is(err, ErrCircuitOpen)
+}
+
+// replayQueue periodically tries to send the queued updates, until the
+// queue is empty.
+func (p *Provider) replayQueue(q *updateQueue) {
+	ctx := context.Background()
+	for {
+		sleep(ctx, p.queueRetryInterval())
+		p.flushQueue(ctx, q)
+
+		q.mu.Lock()
+		if len(q.msgs) == 0 {
+			q.replaying = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+	}
+}
+
+// FlushQueue sends the updates queued while the servers were unreachable,
+// see QueueUpdates, instead of waiting for them to be retried. It also
+// sends the updates saved in QueueFile, so it can be called on startup to
+// send the updates queued before a restart. It returns an error if the
+// servers are still unreachable. Queued updates which fail for another
+// reason are dropped, and their errors are returned.
+func (p *Provider) FlushQueue(ctx context.Context) error {
+	q, err := p.updateQueue()
+	if err != nil {
+		return err
+	}
+	return p.flushQueue(ctx, q)
+}
+
+// flushQueue sends the queued updates in order, stopping at the first one
+// failing because the servers are unreachable. The zone of each update is
+// locked while it's sent, so that it doesn't interleave with other changes.
+func (p *Provider) flushQueue(ctx context.Context, q *updateQueue) error {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+
+	var errs []error
+	for {
+		q.mu.Lock()
+		if len(q.msgs) == 0 {
+			q.mu.Unlock()
+			return errors.Join(errs...)
+		}
+		msg := q.msgs[0]
+		q.mu.Unlock()
+
+		zone := msg.Question[0].Name
+		unlock, err := p.lockZone(ctx, zone)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		err = p.deliverUpdate(ctx, msg)
+		p.invalidateCache(zone)
+		unlock()
+		if err != nil && (ctx.Err() != nil || isUnreachable(err)) {
+			return errors.Join(append(errs, err)...)
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("queued update of %v dropped: %w", zone, err))
+			if p.Logger != nil {
+				p.Logger.LogAttrs(ctx, slog.LevelError, "Queued DNS update failed",
+					slog.String("zone", zone),
+					slog.Any("error", err),
+				)
+			}
+		}
+
+		q.mu.Lock()
+		q.msgs = q.msgs[1:]
+		saveErr := p.saveQueue(q)
+		q.mu.Unlock()
+		if saveErr != nil {
+			errs = append(errs, saveErr)
+		}
+	}
+}
+
+// saveQueue writes the queued updates to QueueFile, if set. The queue must
+// be locked.
+func (p *Provider) saveQueue(q *updateQueue) error {
+	if p.QueueFile == "" {
+		return nil
+	}
+
+	var buf []byte
+	for _, msg := range q.msgs {
+		packed, err := msg.Pack()
+		if err != nil {
+			return err
+		}
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(packed)))
+		buf = append(buf, packed...)
+	}
+
+	// Replace the file atomically, so that it's never left half-written
+	tmp, err := os.CreateTemp(filepath.Dir(p.QueueFile), filepath.Base(p.QueueFile)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save update queue: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save update queue: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save update queue: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p.QueueFile); err != nil {
+		return fmt.Errorf("failed to save update queue: %w", err)
+	}
+	return nil
+}
+
+// readQueueFile reads the updates saved in a queue file, each one prefixed
+// with its length on two bytes like over TCP.
+func readQueueFile(name string) ([]*dns.Msg, error) {
+	buf, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read update queue: %w", err)
+	}
+
+	var msgs []*dns.Msg
+	for len(buf) > 0 {
+		if len(buf) < 2 || len(buf) < 2+int(binary.BigEndian.Uint16(buf)) {
+			return nil, fmt.Errorf("invalid update queue file %v", name)
+		}
+		n := int(binary.BigEndian.Uint16(buf))
+		msg := new(dns.Msg)
+		if err := msg.Unpack(buf[2 : 2+n]); err != nil {
+			return nil, fmt.Errorf("invalid update queue file %v: %w", name, err)
+		}
+		msgs = append(msgs, msg)
+		buf = buf[2+n:]
+	}
+	return msgs, nil
+}
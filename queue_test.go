@@ -0,0 +1,73 @@
+package dnsupdate_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libdns/dnsupdate"
+	"github.com/libdns/libdns"
+)
+
+func TestQueueUpdates(t *testing.T) {
+	srv, _ := newTestServer(t)
+	queueFile := filepath.Join(t.TempDir(), "queue")
+	ctx := context.Background()
+
+	// Nothing listens on the discard port
+	p := srv.Provider()
+	p.Addr = "127.0.0.1:9"
+	p.QueueUpdates = true
+	p.QueueRetryInterval = time.Hour
+	p.RetryBackoff = time.Millisecond
+	p.QueueFile = queueFile
+	for _, text := range []string{"1", "2"} {
+		if _, err := p.AppendRecords(ctx, testZone, []libdns.Record{libdns.TXT{Name: "a", Text: text}}); err != nil {
+			t.Fatalf("queued update failed: %v", err)
+		}
+	}
+	if err := p.FlushQueue(ctx); err == nil {
+		t.Fatal("FlushQueue succeeded while the server is unreachable")
+	}
+	if got := serverRecords(srv); len(got) != 0 {
+		t.Fatalf("server holds %d records before the queue is flushed, want none", len(got))
+	}
+
+	// The queue is read back from the file, as after a restart
+	p = srv.Provider()
+	p.QueueUpdates = true
+	p.QueueFile = queueFile
+	if err := p.FlushQueue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := serverRecords(srv); len(got) != 2 {
+		t.Errorf("server holds %d records after the queue is flushed, want 2", len(got))
+	}
+	if err := p.FlushQueue(ctx); err != nil {
+		t.Errorf("flushing the empty queue: %v", err)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	srv, p := newTestServer(t)
+	p.Addr = "127.0.0.1:9"
+	p.QueueUpdates = true
+	p.QueueSize = 1
+	p.QueueRetryInterval = time.Hour
+	p.RetryBackoff = time.Millisecond
+	ctx := context.Background()
+
+	recs := txtRecords(2)
+	if _, err := p.AppendRecords(ctx, testZone, recs[:1]); err != nil {
+		t.Fatalf("queued update failed: %v", err)
+	}
+	_, err := p.AppendRecords(ctx, testZone, recs[1:])
+	if !errors.Is(err, dnsupdate.ErrQueueFull) {
+		t.Errorf("AppendRecords error = %v, want %v", err, dnsupdate.ErrQueueFull)
+	}
+	if got := serverRecords(srv); len(got) != 0 {
+		t.Errorf("server holds %d records, want none", len(got))
+	}
+}
@@ -0,0 +1,28 @@
+package dnsupdate
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// waitRateLimit blocks until the rate limit allows sending a message to the
+// server.
+func (p *Provider) waitRateLimit(ctx context.Context, addr string) error {
+	if p.RateLimit <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	limiter, ok := p.limiters[addr]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(p.RateLimit), 1)
+		if p.limiters == nil {
+			p.limiters = make(map[string]*rate.Limiter)
+		}
+		p.limiters[addr] = limiter
+	}
+	p.mu.Unlock()
+
+	return limiter.Wait(ctx)
+}
@@ -0,0 +1,208 @@
+package dnsupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// recordIDPrefix starts the IDs returned by RecordID, and identifies the
+// version of the scheme.
+const recordIDPrefix = "r1-"
+
+// recordIDSize is the number of bytes of the digest kept in record IDs.
+const recordIDSize = 15
+
+var recordIDEncoding = base32.NewEncoding("0123456789abcdefghijklmnopqrstuv").WithPadding(base32.NoPadding)
+
+// RecordID returns a compact identifier of a record, which only depends on
+// its content, so that it's stable regardless of how servers and libraries
+// format the record. Records differing only by their TTL have the same ID.
+// Records returned by the provider, except generic libdns.RR records, hold
+// their ID as ProviderData, which DeleteRecords uses to find them.
+//
+// The ID is "r1-" followed by the first 15 bytes of the SHA-256 digest of
+// the record in the canonical wire format of RFC 4034 section 6.2, with the
+// TTL set to zero, encoded with the lowercase base32hex alphabet without
+// padding.
+func RecordID(zone string, record libdns.Record) (string, error) {
+	rr, err := ToRR(zone, record)
+	if err != nil {
+		return "", err
+	}
+	return rrID(rr)
+}
+
+// rrID returns the record ID of a RR.
+func rrID(rr dns.RR) (string, error) {
+	rr = canonicalRR(rr)
+	buf := make([]byte, dns.Len(rr))
+	n, err := dns.PackRR(rr, buf, 0, nil, false)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(buf[:n])
+	return recordIDPrefix + recordIDEncoding.EncodeToString(digest[:recordIDSize]), nil
+}
+
+// ParseRecordID checks the syntax of a record ID returned by RecordID, and
+// returns the digest it holds.
+func ParseRecordID(id string) ([]byte, error) {
+	s, ok := strings.CutPrefix(id, recordIDPrefix)
+	if !ok {
+		return nil, fmt.Errorf("invalid record ID %q: unknown scheme", id)
+	}
+	// Trailing bits are ignored by the decoder, so the encoding must be the
+	// canonical one
+	digest, err := recordIDEncoding.DecodeString(s)
+	if err != nil || len(digest) != recordIDSize || recordIDEncoding.EncodeToString(digest) != s {
+		return nil, fmt.Errorf("invalid record ID %q", id)
+	}
+	return digest, nil
+}
+
+// canonicalRR returns a copy of a RR in canonical form (RFC 4034 section
+// 6.2): lowercase names, including in the data of the types listed there,
+// and the class IN. The TTL is set to zero.
+func canonicalRR(rr dns.RR) dns.RR {
+	rr = dns.Copy(rr)
+	hdr := rr.Header()
+	hdr.Name = dns.CanonicalName(hdr.Name)
+	hdr.Class = dns.ClassINET
+	hdr.Ttl = 0
+
+	switch rr := rr.(type) {
+	case *dns.NS:
+		rr.Ns = dns.CanonicalName(rr.Ns)
+	case *dns.CNAME:
+		rr.Target = dns.CanonicalName(rr.Target)
+	case *dns.DNAME:
+		rr.Target = dns.CanonicalName(rr.Target)
+	case *dns.PTR:
+		rr.Ptr = dns.CanonicalName(rr.Ptr)
+	case *dns.MX:
+		rr.Mx = dns.CanonicalName(rr.Mx)
+	case *dns.SRV:
+		rr.Target = dns.CanonicalName(rr.Target)
+	case *dns.SOA:
+		rr.Ns = dns.CanonicalName(rr.Ns)
+		rr.Mbox = dns.CanonicalName(rr.Mbox)
+	case *dns.NAPTR:
+		rr.Replacement = dns.CanonicalName(rr.Replacement)
+	case *dns.KX:
+		rr.Exchanger = dns.CanonicalName(rr.Exchanger)
+	case *dns.RP:
+		rr.Mbox = dns.CanonicalName(rr.Mbox)
+		rr.Txt = dns.CanonicalName(rr.Txt)
+	case *dns.AFSDB:
+		rr.Hostname = dns.CanonicalName(rr.Hostname)
+	}
+	return rr
+}
+
+// withRecordID sets the record ID of a record as its ProviderData, for the
+// libdns types having this field.
+func withRecordID(record libdns.Record, id string) libdns.Record {
+	if id == "" {
+		return record
+	}
+	switch r := record.(type) {
+	case libdns.Address:
+		r.ProviderData = id
+		return r
+	case libdns.CAA:
+		r.ProviderData = id
+		return r
+	case libdns.CNAME:
+		r.ProviderData = id
+		return r
+	case libdns.MX:
+		r.ProviderData = id
+		return r
+	case libdns.NS:
+		r.ProviderData = id
+		return r
+	case libdns.SRV:
+		r.ProviderData = id
+		return r
+	case libdns.ServiceBinding:
+		r.ProviderData = id
+		return r
+	case libdns.TXT:
+		r.ProviderData = id
+		return r
+	default:
+		return record
+	}
+}
+
+// recordIDOf returns the record ID held as ProviderData by a record, or an
+// empty string if it holds none.
+func recordIDOf(record libdns.Record) string {
+	var data any
+	switch r := record.(type) {
+	case libdns.Address:
+		data = r.ProviderData
+	case libdns.CAA:
+		data = r.ProviderData
+	case libdns.CNAME:
+		data = r.ProviderData
+	case libdns.MX:
+		data = r.ProviderData
+	case libdns.NS:
+		data = r.ProviderData
+	case libdns.SRV:
+		data = r.ProviderData
+	case libdns.ServiceBinding:
+		data = r.ProviderData
+	case libdns.TXT:
+		data = r.ProviderData
+	}
+	id, _ := data.(string)
+	if _, err := ParseRecordID(id); err != nil {
+		return ""
+	}
+	return id
+}
+
+// resolveRecordIDs replaces the deletions of records whose content no longer
+// matches their record ID with the deletions of the records of the zone
+// having these IDs. The zone is only transferred if needed. Records whose ID
+// isn't found in the zone are deleted by content.
+func (p *Provider) resolveRecordIDs(ctx context.Context, zone string, records []libdns.Record, rrs []dns.RR) error {
+	var current map[string]dns.RR
+	for i, record := range records {
+		id := recordIDOf(record)
+		if id == "" || rrs[i].Header().Class != dns.ClassNONE {
+			continue
+		}
+		if got, err := rrID(rrs[i]); err == nil && got == id {
+			continue
+		}
+
+		if current == nil {
+			zoneRRs, err := p.transferZone(ctx, zone)
+			if err != nil {
+				return fmt.Errorf("failed to find records by ID: %w", err)
+			}
+			current = make(map[string]dns.RR, len(zoneRRs))
+			for _, rr := range zoneRRs {
+				if zoneID, err := rrID(rr); err == nil {
+					current[zoneID] = rr
+				}
+			}
+		}
+		if rr, ok := current[id]; ok {
+			rr = dns.Copy(rr)
+			rr.Header().Class = dns.ClassNONE
+			rr.Header().Ttl = 0
+			rrs[i] = rr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package dnsupdate
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestRecordID(t *testing.T) {
+	// The ID of the canonical wire format of www.example.org. 0 IN A 192.0.2.1
+	const want = "r1-g8hlldiia9eteoa3mf847aj6"
+	for _, test := range []struct {
+		zone   string
+		record libdns.Record
+	}{
+		{"example.org.", libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")}},
+		{"example.org.", libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")}},
+		{"EXAMPLE.org.", libdns.Address{Name: "WWW", IP: netip.MustParseAddr("192.0.2.1")}},
+		{"org.", libdns.RR{Name: "www.example", Type: "A", Data: "192.0.2.1"}},
+		{"example.org.", libdns.RR{Name: "www.example.org.", Type: "A", Data: " 192.0.2.1 "}},
+	} {
+		id, err := RecordID(test.zone, test.record)
+		if err != nil {
+			t.Errorf("RecordID(%q, %v): %v", test.zone, test.record, err)
+		} else if id != want {
+			t.Errorf("RecordID(%q, %v) = %q, want %q", test.zone, test.record, id, want)
+		}
+	}
+
+	// Names in the data are compared in lowercase
+	a, err := RecordID("example.org.", libdns.CNAME{Name: "www", Target: "Web.Example.org."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := RecordID("example.org.", libdns.CNAME{Name: "www", Target: "web.example.org."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("CNAME targets differing by case have IDs %q and %q", a, b)
+	}
+
+	// Other data isn't
+	a, err = RecordID("example.org.", libdns.TXT{Name: "www", Text: "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = RecordID("example.org.", libdns.TXT{Name: "www", Text: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("TXT records differing by case have the same ID %q", a)
+	}
+}
+
+func TestParseRecordID(t *testing.T) {
+	for _, test := range []struct {
+		id  string
+		err string
+	}{
+		{id: "r1-g8hlldiia9eteoa3mf847aj6"},
+		{id: "r1-000000000000000000000000"},
+		{id: "r2-g8hlldiia9eteoa3mf847aj6", err: "unknown scheme"},
+		{id: "g8hlldiia9eteoa3mf847aj6", err: "unknown scheme"},
+		{id: "r1-g8hlldiia9eteoa3mf847aj", err: "invalid record ID"},
+		{id: "r1-g8hlldiia9eteoa3mf847aj6g", err: "invalid record ID"},
+		{id: "r1-G8HLLDIIA9ETEOA3MF847AJ6", err: "invalid record ID"},
+		{id: "r1-w8hlldiia9eteoa3mf847aj6", err: "invalid record ID"},
+		{id: "", err: "unknown scheme"},
+	} {
+		digest, err := ParseRecordID(test.id)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("ParseRecordID(%q): %v", test.id, err)
+			} else if len(digest) != recordIDSize {
+				t.Errorf("ParseRecordID(%q) returned %d bytes, want %d", test.id, len(digest), recordIDSize)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("ParseRecordID(%q) error = %v, want %q", test.id, err, test.err)
+		}
+	}
+
+	// IDs returned by RecordID are parsed back
+	id, err := RecordID("example.org.", libdns.TXT{Name: "www", Text: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseRecordID(id); err != nil {
+		t.Errorf("ParseRecordID(%q): %v", id, err)
+	}
+}
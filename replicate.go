@@ -0,0 +1,126 @@
+package dnsupdate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// ReplicaResult is the outcome of an update sent to one of the servers with
+// ReplicationPolicy.
+type ReplicaResult struct {
+	// Address of the server.
+	Server string
+
+	// Reply of the server, if it accepted the update.
+	Reply *dns.Msg
+
+	// Error if the server failed to apply the update.
+	Err error
+}
+
+// ReplicationError is returned when too many servers failed to apply an
+// update sent with ReplicationPolicy.
+type ReplicationError struct {
+	Policy  string
+	Results []ReplicaResult
+}
+
+func (err *ReplicationError) Error() string {
+	var failures []string
+	for _, r := range err.Results {
+		if r.Err != nil {
+			failures = append(failures, r.Err.Error())
+		}
+	}
+	return fmt.Sprintf("update failed on %d of %d servers, policy %q not met: %v",
+		len(failures), len(err.Results), err.Policy, strings.Join(failures, "; "))
+}
+
+// Unwrap returns the errors of the servers which failed.
+func (err *ReplicationError) Unwrap() []error {
+	var errs []error
+	for _, r := range err.Results {
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+	}
+	return errs
+}
+
+// replicationQuorum returns the number of servers which must apply an update
+// according to ReplicationPolicy.
+func (p *Provider) replicationQuorum(servers int) (int, error) {
+	switch p.ReplicationPolicy {
+	case "all":
+		return servers, nil
+	case "majority":
+		return servers/2 + 1, nil
+	case "any":
+		return 1, nil
+	default:
+		return 0, fmt.Errorf("invalid replication policy %q, expected all, majority or any", p.ReplicationPolicy)
+	}
+}
+
+// replicate sends an update to all the servers in parallel, and checks the
+// outcome against ReplicationPolicy. The reply of the first server which
+// applied the update is returned.
+func (p *Provider) replicate(ctx context.Context, addrs []string, query *dns.Msg) (*dns.Msg, error) {
+	quorum, err := p.replicationQuorum(len(addrs))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ReplicaResult, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply, err := p.retryServers(ctx, []string{addr}, query)
+			if err != nil {
+				reply = nil
+			}
+			results[i] = ReplicaResult{Server: addr, Reply: reply, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	var (
+		reply     *dns.Msg
+		succeeded int
+	)
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		if reply == nil {
+			reply = r.Reply
+		}
+		succeeded++
+	}
+
+	zone := query.Question[0].Name
+	if p.ReplicationFunc != nil {
+		p.ReplicationFunc(zone, results)
+	}
+	if succeeded < quorum {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, &ReplicationError{Policy: p.ReplicationPolicy, Results: results}
+	}
+	if succeeded < len(addrs) && p.Logger != nil {
+		p.Logger.LogAttrs(ctx, slog.LevelWarn, "DNS update not applied by all servers",
+			slog.String("zone", zone),
+			slog.Int("succeeded", succeeded),
+			slog.Int("servers", len(addrs)),
+		)
+	}
+	return reply, nil
+}
@@ -0,0 +1,69 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultMaxAttempts  = 3
+	defaultRetryBackoff = 500 * time.Millisecond
+)
+
+func (p *Provider) maxAttempts() int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+func (p *Provider) retryBackoff() time.Duration {
+	if p.RetryBackoff > 0 {
+		return p.RetryBackoff
+	}
+	return defaultRetryBackoff
+}
+
+// isTransient reports whether a query failing with err is worth retrying.
+func isTransient(err error) bool {
+	var (
+		netErr   net.Error
+		rcodeErr RcodeError
+	)
+	switch {
+	case errors.As(err, &rcodeErr):
+		return int(rcodeErr) == dns.RcodeServerFailure
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	default:
+		return errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, syscall.ECONNREFUSED) ||
+			errors.Is(err, io.EOF) ||
+			errors.Is(err, io.ErrUnexpectedEOF)
+	}
+}
+
+// jitter returns a random duration between d/2 and d.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + rand.N(d/2+1)
+}
+
+// sleep waits for the given duration, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,60 @@
+package dnsupdate
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// ErrOutOfScope is returned when an update would change a name outside of
+// the names allowed by Scope.
+var ErrOutOfScope = errors.New("name outside of the provider scope")
+
+// checkScope checks that an update message only changes names allowed by
+// Scope.
+func (p *Provider) checkScope(msg *dns.Msg) error {
+	if len(p.Scope) == 0 {
+		return nil
+	}
+	for _, rr := range msg.Ns {
+		name := rr.Header().Name
+		if !slices.ContainsFunc(p.Scope, func(pattern string) bool {
+			return inScope(name, pattern)
+		}) {
+			return fmt.Errorf("%w: %v", ErrOutOfScope, name)
+		}
+	}
+	return nil
+}
+
+// inScope reports whether a name, or one of its parent domains, matches a
+// scope pattern. A "*" label in the pattern matches one or more labels.
+func inScope(name, pattern string) bool {
+	labels := dns.SplitDomainName(dns.CanonicalName(name))
+	patternLabels := dns.SplitDomainName(dns.CanonicalName(pattern))
+	for i := range labels {
+		if matchLabels(labels[i:], patternLabels) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLabels reports whether labels match pattern labels exactly.
+func matchLabels(labels, pattern []string) bool {
+	switch {
+	case len(pattern) == 0:
+		return len(labels) == 0
+	case pattern[0] == "*":
+		for i := 1; i <= len(labels); i++ {
+			if matchLabels(labels[i:], pattern[1:]) {
+				return true
+			}
+		}
+		return false
+	default:
+		return len(labels) > 0 && labels[0] == pattern[0] && matchLabels(labels[1:], pattern[1:])
+	}
+}
@@ -0,0 +1,65 @@
+package dnsupdate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestInScope(t *testing.T) {
+	for _, test := range []struct {
+		name, pattern string
+		in            bool
+	}{
+		{"dyn.example.org.", "dyn.example.org", true},
+		{"host.dyn.example.org.", "dyn.example.org", true},
+		{"a.b.dyn.example.org.", "dyn.example.org.", true},
+		{"HOST.Dyn.Example.org.", "dyn.example.ORG", true},
+		{"dyn.example.org.", "host.dyn.example.org", false},
+		{"www.example.org.", "dyn.example.org", false},
+		{"xdyn.example.org.", "dyn.example.org", false},
+		{"dyn.example.org.evil.com.", "dyn.example.org", false},
+
+		// "*" matches one or more labels
+		{"_acme-challenge.example.org.", "_acme-challenge.*", true},
+		{"_acme-challenge.www.example.org.", "_acme-challenge.*", true},
+		{"token._acme-challenge.example.org.", "_acme-challenge.*", true},
+		{"_acme-challenge.", "_acme-challenge.*", false},
+		{"www.example.org.", "_acme-challenge.*", false},
+		{"example.org.", "_acme-challenge.*", false},
+		{"a.example.org.", "*.example.org", true},
+		{"a.b.example.org.", "*.example.org", true},
+		{"example.org.", "*.example.org", false},
+		{"host.dyn.example.org.", "dyn.*.org", true},
+		{"dyn.a.b.example.org.", "dyn.*.org", true},
+		{"dyn.org.", "dyn.*.org", false},
+		{"anything.", "*", true},
+	} {
+		if in := inScope(test.name, test.pattern); in != test.in {
+			t.Errorf("inScope(%q, %q) = %v, want %v", test.name, test.pattern, in, test.in)
+		}
+	}
+}
+
+func TestCheckScope(t *testing.T) {
+	p := &Provider{Scope: []string{"_acme-challenge.*", "dyn.example.org"}}
+	update := func(names ...string) *dns.Msg {
+		var msg dns.Msg
+		msg.SetUpdate("example.org.")
+		for _, name := range names {
+			msg.Ns = append(msg.Ns, &dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeANY, Class: dns.ClassANY}})
+		}
+		return &msg
+	}
+
+	if err := p.checkScope(update("_acme-challenge.example.org.", "host.dyn.example.org.")); err != nil {
+		t.Errorf("checkScope: %v", err)
+	}
+	if err := p.checkScope(update("_acme-challenge.example.org.", "example.org.")); !errors.Is(err, ErrOutOfScope) {
+		t.Errorf("checkScope error = %v, want %v", err, ErrOutOfScope)
+	}
+	if err := (&Provider{}).checkScope(update("example.org.")); err != nil {
+		t.Errorf("checkScope without Scope: %v", err)
+	}
+}
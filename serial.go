@@ -0,0 +1,126 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultVerifySerialTimeout  = 10 * time.Second
+	defaultVerifySerialInterval = time.Second
+)
+
+func (p *Provider) verifySerialTimeout() time.Duration {
+	if p.VerifySerialTimeout > 0 {
+		return p.VerifySerialTimeout
+	}
+	return defaultVerifySerialTimeout
+}
+
+func (p *Provider) verifySerialInterval() time.Duration {
+	if p.VerifySerialInterval > 0 {
+		return p.VerifySerialInterval
+	}
+	return defaultVerifySerialInterval
+}
+
+// sendVerifiedUpdate sends an update message, and waits for the SOA serial
+// of the zone to increase.
+func (p *Provider) sendVerifiedUpdate(ctx context.Context, query *dns.Msg) error {
+	zone := query.Question[0].Name
+	before, err := p.querySerial(ctx, zone)
+	if err != nil {
+		return fmt.Errorf("failed to query SOA serial before update: %w", err)
+	}
+
+	if _, err := p.roundTrip(ctx, query); err != nil {
+		return err
+	}
+	return p.waitSerial(ctx, zone, before)
+}
+
+// waitSerial polls the SOA serial of a zone until it's greater than before.
+func (p *Provider) waitSerial(ctx context.Context, zone string, before uint32) error {
+	waitCtx, cancel := context.WithTimeout(ctx, p.verifySerialTimeout())
+	defer cancel()
+
+	for {
+		serial, err := p.querySerial(waitCtx, zone)
+		if err == nil && serialGreater(serial, before) {
+			return nil
+		}
+
+		if sleepErr := sleep(waitCtx, p.verifySerialInterval()); sleepErr != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			} else if err != nil {
+				return fmt.Errorf("failed to verify SOA serial after update: %w", err)
+			}
+			return fmt.Errorf("SOA serial of %v still %d after update", zone, serial)
+		}
+	}
+}
+
+// serialGreater compares SOA serials using sequence space arithmetic
+// (RFC 1982), so that serials wrapping around are handled.
+func serialGreater(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
+
+// TouchZone increments the SOA serial of the zone, without changing its
+// records, for instance to make the primary server send NOTIFY messages and
+// secondary servers transfer the zone again. The serial is read, incremented
+// following RFC 1982 so that it wraps around, and written back with an
+// update conditional on the serial being unchanged, which fails with
+// ErrNXRRSet if the zone was changed meanwhile. It returns the new serial.
+//
+// Servers maintaining serials themselves may still increment the serial
+// further, or ignore the change.
+func (p *Provider) TouchZone(ctx context.Context, zone string) (_ uint32, err error) {
+	ctx, span := p.startSpan(ctx, "TouchZone", zone)
+	defer func() { endSpan(span, err) }()
+
+	zone, err = p.resolveZone(zone)
+	if err != nil {
+		return 0, err
+	}
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	rrs, err := p.lookupRRset(ctx, zone, dns.TypeSOA)
+	if err != nil {
+		return 0, err
+	}
+	if len(rrs) != 1 {
+		return 0, fmt.Errorf("no SOA record found for %v", zone)
+	}
+	soa := rrs[0].(*dns.SOA)
+	before := dns.Copy(soa)
+	before.Header().Ttl = 0
+	soa.Serial++
+
+	var query dns.Msg
+	query.SetUpdate(zone)
+	query.Used([]dns.RR{before})
+	query.Insert([]dns.RR{soa})
+
+	if err := p.checkChanges(ctx, &query); err != nil {
+		return 0, err
+	}
+	defer p.invalidateCache(zone)
+	if err := ignoreQueued(p.sendUpdate(ctx, &query)); err != nil {
+		if errors.Is(err, ErrNXRRSet) {
+			return 0, fmt.Errorf("SOA record of %v changed during update: %w", zone, err)
+		}
+		return 0, err
+	}
+	return soa.Serial, nil
+}
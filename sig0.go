@@ -0,0 +1,88 @@
+package dnsupdate
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// sig0Key returns the SIG(0) key used to sign messages. The key files are
+// read every time so that rotated keys are picked up.
+func (p *Provider) sig0Key() (*sig0Key, error) {
+	// Keys generated by dnssec-keygen come as a pair of files, with the
+	// public key in a ".key" file next to the ".private" file
+	publicKeyFile := strings.TrimSuffix(p.SIG0KeyFile, ".private") + ".key"
+	b, err := os.ReadFile(publicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SIG(0) public key: %w", err)
+	}
+	rr, err := dns.NewRR(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SIG(0) public key: %w", err)
+	}
+
+	var publicKey *dns.KEY
+	switch rr := rr.(type) {
+	case *dns.KEY:
+		publicKey = rr
+	case *dns.DNSKEY:
+		publicKey = &dns.KEY{DNSKEY: *rr}
+	default:
+		return nil, fmt.Errorf("invalid SIG(0) public key record type %v", dns.TypeToString[rr.Header().Rrtype])
+	}
+
+	f, err := os.Open(p.SIG0KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SIG(0) private key: %w", err)
+	}
+	defer f.Close()
+
+	privateKey, err := publicKey.ReadPrivateKey(f, p.SIG0KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SIG(0) private key: %w", err)
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported SIG(0) private key type %T", privateKey)
+	}
+
+	return &sig0Key{
+		name:      dns.CanonicalName(publicKey.Header().Name),
+		algorithm: publicKey.Algorithm,
+		keyTag:    publicKey.KeyTag(),
+		signer:    signer,
+	}, nil
+}
+
+type sig0Key struct {
+	name      string
+	algorithm uint8
+	keyTag    uint16
+	signer    crypto.Signer
+}
+
+func (key *sig0Key) sign(msg *dns.Msg) (buf []byte, sig string, err error) {
+	now := uint32(time.Now().Unix())
+	rr := &dns.SIG{
+		RRSIG: dns.RRSIG{
+			Algorithm:  key.algorithm,
+			SignerName: key.name,
+			KeyTag:     key.keyTag,
+			Inception:  now - 300,
+			Expiration: now + 300,
+		},
+	}
+	buf, err = rr.Sign(key.signer, msg)
+	return buf, "", err
+}
+
+// verify accepts all the replies: unlike with TSIG, the key is only held by
+// the client, and servers such as BIND and Knot don't sign their replies
+// with keys of their own, so replies aren't authenticated.
+func (key *sig0Key) verify(buf []byte, reply *dns.Msg, requestSig string) error {
+	return nil
+}
@@ -0,0 +1,74 @@
+package dnsupdate
+
+import (
+	"context"
+
+	"github.com/miekg/dns"
+)
+
+// signer authenticates outgoing messages, and verifies the replies.
+type signer interface {
+	// sign packs a signed copy of the message. It returns the signature,
+	// needed to verify the reply.
+	sign(msg *dns.Msg) (buf []byte, sig string, err error)
+	// verify checks the signature of a reply, if any.
+	verify(buf []byte, reply *dns.Msg, requestSig string) error
+}
+
+// signer returns the signer used to authenticate messages about a zone sent
+// to a server, or nil if messages should not be signed.
+func (p *Provider) signer(ctx context.Context, addr, zone string) (signer, error) {
+	// Keys set with WithKey or WithView take precedence
+	override, err := p.keyOverride(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if override == nil {
+		if p.GSSTSIG {
+			key, err := p.gssTSIGKey(ctx, addr)
+			if err != nil {
+				return nil, err
+			}
+			// The negotiated key is shared, while verify records the time
+			// of the server in the key of each exchange
+			exchangeKey := *key
+			exchangeKey.offset = p.clockOffset(addr)
+			return &exchangeKey, nil
+		}
+		if p.SIG0KeyFile != "" {
+			return p.sig0Key()
+		}
+	}
+
+	key, err := p.tsigKey(ctx, zone)
+	if key == nil || err != nil {
+		return nil, err
+	}
+	key.offset = p.clockOffset(addr)
+	return key, nil
+}
+
+// packMsg packs a message, signing it if a signer is provided.
+func packMsg(msg *dns.Msg, s signer) (buf []byte, sig string, err error) {
+	if s == nil {
+		buf, err = msg.Pack()
+		return buf, "", err
+	}
+	return s.sign(msg)
+}
+
+// unpackReply unpacks a reply, verifying its signature if a signer is
+// provided.
+func unpackReply(buf []byte, s signer, requestSig string) (*dns.Msg, error) {
+	var reply dns.Msg
+	if err := reply.Unpack(buf); err != nil {
+		return nil, err
+	}
+
+	if s != nil {
+		if err := s.verify(buf, &reply, requestSig); err != nil {
+			return nil, err
+		}
+	}
+	return &reply, nil
+}
@@ -0,0 +1,118 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+
+	"github.com/miekg/dns"
+)
+
+// defaultMaxMessageSize is the default maximum size of update messages,
+// leaving room for signatures and EDNS0 options below the 64 KiB limit.
+const defaultMaxMessageSize = dns.MaxMsgSize - 1024
+
+func (p *Provider) maxMessageSize() int {
+	if p.MaxMessageSize > 0 {
+		return p.MaxMessageSize
+	}
+	return defaultMaxMessageSize
+}
+
+// update sends an update message, split into several messages if it's too
+// large, or if its records belong to several zones with AutoZone. It returns
+// errQueued if any of them was queued.
+func (p *Provider) update(ctx context.Context, query *dns.Msg) error {
+	// Check the whole update before sending parts of it
+	if err := p.checkChanges(ctx, query); err != nil {
+		return err
+	}
+	defer p.invalidateCache(query.Question[0].Name)
+
+	zoneMsgs := []*dns.Msg{query}
+	if p.AutoZone {
+		var err error
+		zoneMsgs, err = p.splitZones(ctx, query)
+		if err != nil {
+			return err
+		}
+	}
+	for _, zoneMsg := range zoneMsgs {
+		if err := p.checkMaxDeletes(ctx, zoneMsg); err != nil {
+			return err
+		}
+	}
+	if !p.DryRun {
+		if err := p.confirmUpdate(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	queued := false
+	for _, zoneMsg := range zoneMsgs {
+		defer p.invalidateCache(zoneMsg.Question[0].Name)
+		for _, msg := range splitUpdate(zoneMsg, p.maxMessageSize()) {
+			if err := p.sendUpdate(ctx, msg); errors.Is(err, errQueued) {
+				queued = true
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	if queued {
+		return errQueued
+	}
+	return nil
+}
+
+// splitUpdate splits an update message into messages smaller than size. The
+// changes to each RRset, such as its removal and the insertion of its new
+// records, are kept in the same message so that they are applied
+// atomically.
+func splitUpdate(query *dns.Msg, size int) []*dns.Msg {
+	if query.Len() <= size {
+		return []*dns.Msg{query}
+	}
+
+	// Group the changes by RRset, in order of appearance
+	var (
+		keys   []rrsetKey
+		groups = make(map[rrsetKey][]dns.RR)
+	)
+	for _, rr := range query.Ns {
+		key := rrsetKeyOf(rr)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], rr)
+	}
+
+	base := query.Copy()
+	base.Ns = nil
+	baseLen := base.Len()
+
+	var (
+		msgs []*dns.Msg
+		msg  *dns.Msg
+		n    int
+		buf  = make([]byte, dns.MaxMsgSize)
+	)
+	for _, key := range keys {
+		var groupLen int
+		for _, rr := range groups[key] {
+			if off, err := dns.PackRR(rr, buf, 0, nil, false); err == nil {
+				groupLen += off
+			}
+		}
+
+		// Groups larger than the limit end up alone in their message
+		if msg == nil || n+groupLen > size {
+			msg = base.Copy()
+			msg.Id = dns.Id()
+			msgs = append(msgs, msg)
+			n = baseLen
+		}
+		msg.Ns = append(msg.Ns, groups[key]...)
+		n += groupLen
+	}
+	return msgs
+}
@@ -0,0 +1,78 @@
+package dnsupdate_test
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/dnsupdate"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// countUpdates returns a middleware counting the update messages sent.
+func countUpdates(n *int) dnsupdate.Middleware {
+	var mu sync.Mutex
+	return func(next dnsupdate.ExchangeFunc) dnsupdate.ExchangeFunc {
+		return func(ctx context.Context, server string, msg *dns.Msg) (*dns.Msg, error) {
+			if msg.Opcode == dns.OpcodeUpdate {
+				mu.Lock()
+				*n++
+				mu.Unlock()
+			}
+			return next(ctx, server, msg)
+		}
+	}
+}
+
+func TestSplitUpdate(t *testing.T) {
+	srv, p := newTestServer(t)
+	p.MaxMessageSize = 2000
+	var updates int
+	p.Middleware = []dnsupdate.Middleware{countUpdates(&updates)}
+	ctx := context.Background()
+
+	recs := txtRecords(200)
+	if _, err := p.AppendRecords(ctx, testZone, recs); err != nil {
+		t.Fatal(err)
+	}
+	if updates < 2 {
+		t.Errorf("sent %d update messages, want several", updates)
+	}
+	if got := serverRecords(srv); len(got) != len(recs) {
+		t.Errorf("server holds %d records, want %d", len(got), len(recs))
+	}
+}
+
+func TestSplitUpdateSet(t *testing.T) {
+	srv, p := newTestServer(t)
+	p.MaxMessageSize = 2000
+	var updates int
+	p.Middleware = []dnsupdate.Middleware{countUpdates(&updates)}
+	ctx := context.Background()
+
+	// Each RRset is replaced in a single message, even when the update is
+	// split
+	var recs []libdns.Record
+	for i := range 200 {
+		recs = append(recs, libdns.Address{
+			Name: fmt.Sprintf("h%d", i%50),
+			TTL:  time.Minute,
+			IP:   netip.AddrFrom4([4]byte{10, 0, 0, byte(i)}),
+		})
+	}
+	for range 2 {
+		if _, err := p.SetRecords(ctx, testZone, recs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if updates < 4 {
+		t.Errorf("sent %d update messages, want several for each call", updates)
+	}
+	if got := serverRecords(srv); len(got) != len(recs) {
+		t.Errorf("server holds %d records, want %d", len(got), len(recs))
+	}
+}
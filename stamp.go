@@ -0,0 +1,235 @@
+package dnsupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DNS stamp protocol identifiers, see https://dnscrypt.info/stamps-specifications.
+const (
+	stampPlain    = 0x00
+	stampDNSCrypt = 0x01
+	stampDoH      = 0x02
+	stampDoT      = 0x03
+	stampDoQ      = 0x04
+)
+
+func isStampAddr(addr string) bool {
+	return strings.HasPrefix(addr, "sdns://")
+}
+
+// dnsStamp holds the server information encoded in a DNS stamp.
+type dnsStamp struct {
+	proto    byte
+	addr     string
+	hashes   [][]byte
+	hostname string
+	path     string
+}
+
+// stampServer holds the information from a DNS stamp needed to connect to a
+// server by host name.
+type stampServer struct {
+	ip     string
+	hashes [][]byte
+}
+
+// parseStamp decodes a "sdns://" DNS stamp.
+func parseStamp(s string) (*dnsStamp, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, "sdns://"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS stamp %q: %w", s, err)
+	}
+
+	r := stampReader{b: b}
+	stamp := &dnsStamp{proto: r.byte()}
+	r.skip(8) // Properties
+	stamp.addr = string(r.lp())
+	switch stamp.proto {
+	case stampPlain:
+	case stampDoH, stampDoT, stampDoQ:
+		stamp.hashes = r.vlp()
+		stamp.hostname = string(r.lp())
+		if stamp.proto == stampDoH {
+			stamp.path = string(r.lp())
+		}
+	case stampDNSCrypt:
+		return nil, fmt.Errorf("unsupported DNS stamp %q: DNSCrypt isn't supported", s)
+	default:
+		return nil, fmt.Errorf("unsupported DNS stamp %q: unknown protocol %#x", s, stamp.proto)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid DNS stamp %q: %w", s, r.err)
+	}
+	for _, hash := range stamp.hashes {
+		if len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid DNS stamp %q: invalid certificate hash", s)
+		}
+	}
+	return stamp, nil
+}
+
+// serverAddr returns the server address matching the stamp, and the
+// information to connect to the server by host name, if any.
+func (stamp *dnsStamp) serverAddr() (addr string, server *stampServer) {
+	// The address is an IP address, with an optional port
+	ip, port := stamp.addr, ""
+	if host, hostPort, err := net.SplitHostPort(stamp.addr); err == nil {
+		ip, port = host, hostPort
+	}
+	ip = strings.Trim(ip, "[]")
+
+	hostname := stamp.hostname
+	if host, hostPort, err := net.SplitHostPort(hostname); err == nil {
+		hostname, port = host, hostPort
+	}
+	if hostname == "" {
+		hostname = ip
+	}
+	if hostname != ip {
+		server = &stampServer{ip: ip, hashes: stamp.hashes}
+	} else if len(stamp.hashes) > 0 {
+		server = &stampServer{hashes: stamp.hashes}
+	}
+
+	switch stamp.proto {
+	case stampPlain:
+		return withDefaultPort(stamp.addr), nil
+	case stampDoH:
+		if port != "" {
+			hostname = net.JoinHostPort(hostname, port)
+		} else if strings.Contains(hostname, ":") {
+			hostname = "[" + hostname + "]"
+		}
+		return "https://" + hostname + stamp.path, server
+	case stampDoT:
+		return withDefaultPort("tls://" + joinOptionalPort(hostname, port)), server
+	default:
+		return withDefaultPort("quic://" + joinOptionalPort(hostname, port)), server
+	}
+}
+
+func joinOptionalPort(host, port string) string {
+	if port == "" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// stampReader reads the fields of a DNS stamp.
+type stampReader struct {
+	b   []byte
+	err error
+}
+
+var errShortStamp = errors.New("unexpected end of stamp")
+
+func (r *stampReader) byte() byte {
+	if b := r.take(1); len(b) == 1 {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *stampReader) skip(n int) {
+	r.take(n)
+}
+
+// take reads the next n bytes.
+func (r *stampReader) take(n int) []byte {
+	if len(r.b) < n {
+		r.err = errShortStamp
+		r.b = nil
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+// lp reads a length-prefixed field.
+func (r *stampReader) lp() []byte {
+	return r.take(int(r.byte()))
+}
+
+// vlp reads a set of length-prefixed fields, where the high bit of the
+// length is set for all the fields but the last one.
+func (r *stampReader) vlp() [][]byte {
+	var fields [][]byte
+	for {
+		n := r.byte()
+		if field := r.take(int(n &^ 0x80)); len(field) > 0 {
+			fields = append(fields, field)
+		}
+		if n&0x80 == 0 || r.err != nil {
+			return fields
+		}
+	}
+}
+
+// resolveStamp converts a DNS stamp to the matching server address.
+// Invalid stamps are returned as is, and reported when used.
+func resolveStamp(addr string) string {
+	stamp, err := parseStamp(addr)
+	if err != nil {
+		return addr
+	}
+	addr, _ = stamp.serverAddr()
+	return addr
+}
+
+// stampServer returns the information from the DNS stamp configured for a
+// server host name, if any.
+func (p *Provider) stampServer(host string) *stampServer {
+	for _, addr := range append([]string{p.Addr}, p.Addrs...) {
+		if !isStampAddr(addr) {
+			continue
+		}
+		stamp, err := parseStamp(addr)
+		if err != nil {
+			continue
+		}
+		if addr, server := stamp.serverAddr(); server != nil && strings.EqualFold(serverHostname(addr), host) {
+			return server
+		}
+	}
+	return nil
+}
+
+// stampDialAddr replaces the host name in an address with the IP address
+// given by a DNS stamp, if any.
+func (p *Provider) stampDialAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if server := p.stampServer(host); server != nil && server.ip != "" {
+		return net.JoinHostPort(server.ip, port)
+	}
+	return addr
+}
+
+// verifyStampHashes checks that a certificate in the chain presented by a
+// server has one of the hashes given by its DNS stamp, if any. The hashes
+// cover the to-be-signed part of the certificates.
+func (p *Provider) verifyStampHashes(serverName string, state tls.ConnectionState) error {
+	server := p.stampServer(serverName)
+	if server == nil || len(server.hashes) == 0 {
+		return nil
+	}
+	for _, cert := range state.PeerCertificates {
+		digest := sha256.Sum256(cert.RawTBSCertificate)
+		for _, hash := range server.hashes {
+			if bytes.Equal(hash, digest[:]) {
+				return nil
+			}
+		}
+	}
+	return errors.New("server certificate doesn't match the hashes of its DNS stamp")
+}
@@ -0,0 +1,78 @@
+package dnsupdate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseStamp(t *testing.T) {
+	for _, test := range []struct {
+		stamp  string
+		addr   string
+		ip     string
+		hashes int
+		err    string
+	}{{
+		// Google Public DNS
+		stamp: "sdns://AAcAAAAAAAAABzguOC44Ljg",
+		addr:  "8.8.8.8:53",
+	}, {
+		// Cloudflare DNS-over-HTTPS
+		stamp: "sdns://AgcAAAAAAAAABzEuMC4wLjEAEmRucy5jbG91ZGZsYXJlLmNvbQovZG5zLXF1ZXJ5",
+		addr:  "https://dns.cloudflare.com/dns-query",
+		ip:    "1.0.0.1",
+	}, {
+		stamp:  "sdns://AwAAAAAAAAAABzkuOS45LjkgAAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8NZG5zLnF1YWQ5Lm5ldA",
+		addr:   "tls://dns.quad9.net:853",
+		ip:     "9.9.9.9",
+		hashes: 1,
+	}, {
+		// The port of the address is used with the host name
+		stamp: "sdns://AwAAAAAAAAAAElsyMDAxOmRiODo6MV06ODg1MwAPZG90LmV4YW1wbGUub3Jn",
+		addr:  "tls://dot.example.org:8853",
+		ip:    "2001:db8::1",
+	}, {
+		stamp: "sdns://BAAAAAAAAAAACTE5Mi4wLjIuMQAUZG9xLmV4YW1wbGUub3JnOjg4NTM",
+		addr:  "quic://doq.example.org:8853",
+		ip:    "192.0.2.1",
+	}, {
+		stamp: "sdns://AQAAAAAAAAAACTE5Mi4wLjIuMSAAAQIDBAUGBwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHxsyLmRuc2NyeXB0LWNlcnQuZXhhbXBsZS5vcmc",
+		err:   "DNSCrypt isn't supported",
+	}, {
+		stamp: "sdns://CQAAAAAAAAAABzkuOS45Ljk",
+		err:   "unknown protocol 0x9",
+	}, {
+		stamp: "sdns://AgAAAAAAAAAABzEuMS4xLjEAEGFi",
+		err:   "unexpected end of stamp",
+	}, {
+		stamp: "sdns://AwAAAAAAAAAABzkuOS45LjkDYWJjDWRucy5xdWFkOS5uZXQ",
+		err:   "invalid certificate hash",
+	}, {
+		stamp: "sdns://not base64!",
+		err:   "invalid DNS stamp",
+	}} {
+		stamp, err := parseStamp(test.stamp)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("parseStamp(%q) error = %v, want %q", test.stamp, err, test.err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("parseStamp(%q): %v", test.stamp, err)
+			continue
+		}
+
+		addr, server := stamp.serverAddr()
+		if addr != test.addr {
+			t.Errorf("address of %q = %q, want %q", test.stamp, addr, test.addr)
+		}
+		var ip string
+		var hashes int
+		if server != nil {
+			ip, hashes = server.ip, len(server.hashes)
+		}
+		if ip != test.ip || hashes != test.hashes {
+			t.Errorf("server of %q has IP %q and %d hashes, want %q and %d", test.stamp, ip, hashes, test.ip, test.hashes)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package dnsupdate
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// transferHandler receives the records of a zone transfer as they arrive,
+// and returns false to abort the transfer.
+type transferHandler func(rrs []dns.RR) bool
+
+type transferHandlerKey struct{}
+
+// Records lists all the records in the zone like GetRecords, but yields them
+// as the zone transfer progresses instead of holding them all in memory,
+// for very large zones. Records are always fetched with a full zone
+// transfer, and aren't cached. A transfer failing after some records were
+// yielded isn't retried, the error is yielded instead.
+func (p *Provider) Records(ctx context.Context, zone string) iter.Seq2[libdns.Record, error] {
+	return func(yield func(libdns.Record, error) bool) {
+		var err error
+		ctx, span := p.startSpan(ctx, "Records", zone)
+		defer func() { endSpan(span, err) }()
+
+		zone, err = p.resolveZone(zone)
+		if err == nil {
+			err = p.streamZone(ctx, zone, yield)
+		}
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// streamZone transfers a zone, and yields its records as they arrive.
+func (p *Provider) streamZone(ctx context.Context, zone string, yield func(libdns.Record, error) bool) error {
+	var query dns.Msg
+	query.SetAxfr(zone)
+	query.SetEdns0(p.udpSize(), false)
+
+	addrs, err := p.resolveServers(ctx, &query)
+	if err != nil {
+		return err
+	}
+	excluded, err := p.excludedRR(zone)
+	if err != nil {
+		return err
+	}
+
+	// The zone contents are enclosed in SOA records, only the first one is
+	// yielded
+	var (
+		started, stopped bool
+		soas             int
+	)
+	handle := func(rrs []dns.RR) bool {
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == dns.TypeSOA {
+				soas++
+				if soas > 1 {
+					continue
+				}
+			} else if soas == 0 {
+				continue
+			}
+			if excluded(rr) {
+				continue
+			}
+
+			started = true
+			if !yield(unmarshalRecord(zone, rr), nil) {
+				stopped = true
+				return false
+			}
+		}
+		return true
+	}
+
+	// Other servers are only tried until the first records are yielded
+	streamCtx := context.WithValue(ctx, transferHandlerKey{}, transferHandler(handle))
+	for _, addr := range addrs {
+		var reply *dns.Msg
+		reply, err = p.tryServers(streamCtx, []string{addr}, &query)
+		if err == nil {
+			// Records received with other transports aren't streamed
+			handle(reply.Answer)
+		}
+		if err == nil || started || ctx.Err() != nil {
+			break
+		}
+	}
+	switch {
+	case stopped:
+		// Nothing may be yielded once the consumer stopped
+		return nil
+	case err != nil:
+		return err
+	case soas < 2:
+		return fmt.Errorf("invalid AXFR reply for %v", zone)
+	}
+	return nil
+}
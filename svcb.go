@@ -0,0 +1,176 @@
+package dnsupdate
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// marshalServiceBinding converts a SVCB or HTTPS record to a RR, building
+// each SvcParam from its values rather than parsing their presentation
+// format.
+func marshalServiceBinding(fqdn string, record libdns.ServiceBinding) (dns.RR, error) {
+	r := record.RR()
+	svcb := dns.SVCB{
+		Hdr: dns.RR_Header{
+			Name:   fqdn,
+			Rrtype: dns.TypeSVCB,
+			Class:  dns.ClassINET,
+			Ttl:    uint32(r.TTL / time.Second),
+		},
+		Priority: record.Priority,
+		Target:   dns.Fqdn(record.Target),
+	}
+	for key, values := range record.Params {
+		kv, err := svcbKeyValue(key, values)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SvcParam %v: %w", key, err)
+		}
+		svcb.Value = append(svcb.Value, kv)
+	}
+
+	if r.Type == "HTTPS" {
+		svcb.Hdr.Rrtype = dns.TypeHTTPS
+		return &dns.HTTPS{SVCB: svcb}, nil
+	}
+	return &svcb, nil
+}
+
+// svcbKeyValue builds a SvcParam from its key and values.
+func svcbKeyValue(key string, values []string) (dns.SVCBKeyValue, error) {
+	code, err := parseSVCBKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch code {
+	case dns.SVCB_MANDATORY:
+		kv := &dns.SVCBMandatory{}
+		for _, value := range values {
+			mandatory, err := parseSVCBKey(value)
+			if err != nil {
+				return nil, err
+			}
+			kv.Code = append(kv.Code, mandatory)
+		}
+		return kv, nil
+	case dns.SVCB_ALPN:
+		return &dns.SVCBAlpn{Alpn: values}, nil
+	case dns.SVCB_NO_DEFAULT_ALPN:
+		if len(values) > 0 {
+			return nil, fmt.Errorf("unexpected value")
+		}
+		return &dns.SVCBNoDefaultAlpn{}, nil
+	case dns.SVCB_PORT:
+		if len(values) != 1 {
+			return nil, fmt.Errorf("expected a single port")
+		}
+		port, err := strconv.ParseUint(values[0], 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		return &dns.SVCBPort{Port: uint16(port)}, nil
+	case dns.SVCB_IPV4HINT, dns.SVCB_IPV6HINT:
+		var hints []net.IP
+		for _, value := range values {
+			ip := net.ParseIP(value)
+			if ip == nil || (ip.To4() != nil) != (code == dns.SVCB_IPV4HINT) {
+				return nil, fmt.Errorf("invalid IP address %q", value)
+			}
+			hints = append(hints, ip)
+		}
+		if code == dns.SVCB_IPV4HINT {
+			return &dns.SVCBIPv4Hint{Hint: hints}, nil
+		}
+		return &dns.SVCBIPv6Hint{Hint: hints}, nil
+	case dns.SVCB_ECHCONFIG:
+		if len(values) != 1 {
+			return nil, fmt.Errorf("expected a single ECHConfigList")
+		}
+		ech, err := base64.StdEncoding.DecodeString(values[0])
+		if err != nil {
+			return nil, err
+		}
+		return &dns.SVCBECHConfig{ECH: ech}, nil
+	case dns.SVCB_DOHPATH:
+		if len(values) != 1 {
+			return nil, fmt.Errorf("expected a single URI template")
+		}
+		return &dns.SVCBDoHPath{Template: values[0]}, nil
+	default:
+		return &dns.SVCBLocal{KeyCode: code, Data: []byte(strings.Join(values, ","))}, nil
+	}
+}
+
+// parseSVCBKey parses the name of a SvcParam key, either registered or in
+// the generic "keyNNNNN" form.
+func parseSVCBKey(key string) (dns.SVCBKey, error) {
+	for code := dns.SVCB_MANDATORY; code <= dns.SVCB_DOHPATH; code++ {
+		if code.String() == key {
+			return code, nil
+		}
+	}
+
+	if n, ok := strings.CutPrefix(key, "key"); ok {
+		code, err := strconv.ParseUint(n, 10, 16)
+		if err == nil && code != 65535 {
+			return dns.SVCBKey(code), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown key")
+}
+
+// unmarshalServiceBinding converts a SVCB or HTTPS RR to a record, with the
+// values of each SvcParam.
+func unmarshalServiceBinding(rr dns.RR, svcb *dns.SVCB) (libdns.Record, error) {
+	// Let libdns extract the scheme and port from the owner name
+	r := libdns.RR{
+		Type: dns.Type(rr.Header().Rrtype).String(),
+		Name: rr.Header().Name,
+		Data: fmt.Sprintf("%d %s", svcb.Priority, svcb.Target),
+		TTL:  time.Duration(rr.Header().Ttl) * time.Second,
+	}
+	parsed, err := r.Parse()
+	if err != nil {
+		return nil, err
+	}
+	record := parsed.(libdns.ServiceBinding)
+
+	record.Params = make(libdns.SvcParams, len(svcb.Value))
+	for _, kv := range svcb.Value {
+		var values []string
+		switch kv := kv.(type) {
+		case *dns.SVCBMandatory:
+			for _, code := range kv.Code {
+				values = append(values, code.String())
+			}
+		case *dns.SVCBAlpn:
+			values = kv.Alpn
+		case *dns.SVCBNoDefaultAlpn:
+		case *dns.SVCBIPv4Hint:
+			for _, ip := range kv.Hint {
+				values = append(values, ip.String())
+			}
+		case *dns.SVCBIPv6Hint:
+			for _, ip := range kv.Hint {
+				values = append(values, ip.String())
+			}
+		case *dns.SVCBECHConfig:
+			values = []string{base64.StdEncoding.EncodeToString(kv.ECH)}
+		case *dns.SVCBDoHPath:
+			values = []string{kv.Template}
+		case *dns.SVCBLocal:
+			values = []string{string(kv.Data)}
+		default:
+			values = []string{kv.String()}
+		}
+		record.Params[kv.Key().String()] = values
+	}
+	return record, nil
+}
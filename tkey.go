@@ -0,0 +1,75 @@
+package dnsupdate
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// TKEY modes, see RFC 2930 section 2.5. Only the GSS-API mode of GSS-TSIG
+// and key deletion are implemented: servers don't hand out keys with the
+// other modes anymore, BIND having removed Diffie-Hellman exchanges.
+const (
+	tkeyModeGSSAPI   = 3
+	tkeyModeDeletion = 5
+)
+
+// tkeyLifetime is the requested lifetime of negotiated keys.
+const tkeyLifetime = time.Hour
+
+// exchangeTKEY sends a TKEY query to a server to negotiate a transaction key,
+// as defined in RFC 2930. The query is signed with the given signer, if any.
+// It returns the TKEY record of the reply.
+func (p *Provider) exchangeTKEY(ctx context.Context, addr, keyName, algorithm string, mode uint16, key []byte, s signer) (*dns.TKEY, error) {
+	keyName = dns.CanonicalName(keyName)
+	now := time.Now()
+
+	var query dns.Msg
+	query.SetQuestion(keyName, dns.TypeTKEY)
+	query.Question[0].Qclass = dns.ClassANY
+	query.Extra = append(query.Extra, &dns.TKEY{
+		Hdr:        dns.RR_Header{Name: keyName, Rrtype: dns.TypeTKEY, Class: dns.ClassANY},
+		Algorithm:  algorithm,
+		Mode:       mode,
+		Inception:  uint32(now.Unix()),
+		Expiration: uint32(now.Add(tkeyLifetime).Unix()),
+		KeySize:    uint16(len(key)),
+		Key:        hex.EncodeToString(key),
+	})
+
+	reply, err := p.exchange(ctx, addr, &query, s)
+	if err != nil {
+		return nil, err
+	} else if err := replyTSIGError(reply); err != nil {
+		return nil, err
+	} else if reply.Rcode != dns.RcodeSuccess {
+		return nil, RcodeError(reply.Rcode)
+	}
+
+	for _, rr := range reply.Answer {
+		tkey, ok := rr.(*dns.TKEY)
+		if !ok || dns.CanonicalName(tkey.Hdr.Name) != keyName {
+			continue
+		}
+
+		if tkey.Error != dns.RcodeSuccess {
+			return nil, fmt.Errorf("TKEY negotiation failed: %w", RcodeError(tkey.Error))
+		} else if tkey.Mode != mode {
+			return nil, fmt.Errorf("unexpected TKEY mode %v in reply", tkey.Mode)
+		}
+		return tkey, nil
+	}
+	return nil, errors.New("no TKEY record in reply")
+}
+
+// deleteTKEY asks a server to delete a previously negotiated key. The query
+// must be signed with the key being deleted.
+func (p *Provider) deleteTKEY(ctx context.Context, addr string, key *tsigKey) error {
+	exchangeKey := *key
+	_, err := p.exchangeTKEY(ctx, addr, key.name, key.algorithm, tkeyModeDeletion, nil, &exchangeKey)
+	return err
+}
@@ -0,0 +1,126 @@
+package dnsupdate
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// tlsVersions maps the TLS versions accepted in TLSMinVersion.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// customTLS returns true if the TLS configuration differs from the system
+// defaults.
+func (p *Provider) customTLS() bool {
+	return p.TLSCertFile != "" || p.TLSCAFile != "" || p.TLSServerName != "" ||
+		p.TLSMinVersion != "" || p.TLSInsecureSkipVerify || len(p.TLSPins) > 0 ||
+		isStampAddr(p.Addr) || slices.ContainsFunc(p.Addrs, isStampAddr)
+}
+
+// tlsConfig returns the TLS configuration used to connect to encrypted
+// transports.
+func (p *Provider) tlsConfig(serverName string, protos ...string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         serverName,
+		NextProtos:         protos,
+		InsecureSkipVerify: p.TLSInsecureSkipVerify,
+	}
+	if p.TLSServerName != "" {
+		config.ServerName = p.TLSServerName
+	}
+	if p.TLSCertFile != "" {
+		config.GetClientCertificate = p.clientCertificate
+	}
+
+	if p.TLSMinVersion != "" {
+		version, ok := tlsVersions[p.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid minimum TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", p.TLSMinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if p.TLSCAFile != "" {
+		b, err := os.ReadFile(p.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificate found in TLS CA file %v", p.TLSCAFile)
+		}
+	}
+
+	pins, err := parsePins(p.TLSPins)
+	if err != nil {
+		return nil, err
+	}
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(pins) > 0 {
+			if err := verifyPins(state, pins); err != nil {
+				return err
+			}
+		}
+		// IP addresses aren't sent as server name
+		serverName := state.ServerName
+		if serverName == "" {
+			serverName = config.ServerName
+		}
+		return p.verifyStampHashes(serverName, state)
+	}
+	return config, nil
+}
+
+// parsePins decodes SPKI pins: base64-encoded SHA-256 digests, optionally
+// prefixed with "sha256/".
+func parsePins(pins []string) ([][]byte, error) {
+	var digests [][]byte
+	for _, pin := range pins {
+		digest, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256/"))
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("invalid TLS pin %q, expected a base64-encoded SHA-256 digest", pin)
+		}
+		digests = append(digests, digest)
+	}
+	return digests, nil
+}
+
+// verifyPins checks that a certificate presented by the server has the
+// public key of one of the pins.
+func verifyPins(state tls.ConnectionState, pins [][]byte) error {
+	for _, cert := range state.PeerCertificates {
+		digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if slices.ContainsFunc(pins, func(pin []byte) bool {
+			return string(pin) == string(digest[:])
+		}) {
+			return nil
+		}
+	}
+	return errors.New("server certificate doesn't match any TLS pin")
+}
+
+// clientCertificate loads the TLS client certificate. The files are read
+// for every handshake so that renewed certificates are picked up.
+func (p *Provider) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	keyFile := p.TLSKeyFile
+	if keyFile == "" {
+		keyFile = p.TLSCertFile
+	}
+
+	cert, err := tls.LoadX509KeyPair(p.TLSCertFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS client certificate: %w", err)
+	}
+	return &cert, nil
+}
@@ -0,0 +1,60 @@
+package dnsupdate
+
+import (
+	"context"
+
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/libdns/dnsupdate"
+
+func (p *Provider) tracer() trace.Tracer {
+	if p.TracerProvider == nil {
+		return noop.Tracer{}
+	}
+	return p.TracerProvider.Tracer(tracerName)
+}
+
+// startSpan starts the span of an operation on a zone.
+func (p *Provider) startSpan(ctx context.Context, name, zone string) (context.Context, trace.Span) {
+	return p.tracer().Start(ctx, "dnsupdate."+name, trace.WithAttributes(
+		attribute.String("dns.zone", zone),
+	))
+}
+
+// endSpan ends a span, recording the error of the operation if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startExchangeSpan starts the span of an exchange with a server.
+func (p *Provider) startExchangeSpan(ctx context.Context, addr string, query *dns.Msg) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("server.address", addr),
+		attribute.String("dns.opcode", dns.OpcodeToString[query.Opcode]),
+	}
+	if len(query.Question) > 0 {
+		attrs = append(attrs, attribute.String("dns.zone", query.Question[0].Name))
+	}
+	return p.tracer().Start(ctx, "dnsupdate.exchange", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endExchangeSpan ends the span of an exchange, with the response code of
+// the reply.
+func endExchangeSpan(span trace.Span, reply *dns.Msg, err error) {
+	if err == nil {
+		span.SetAttributes(attribute.String("dns.rcode", dns.RcodeToString[reply.Rcode]))
+		if reply.Rcode != dns.RcodeSuccess {
+			err = RcodeError(reply.Rcode)
+		}
+	}
+	endSpan(span, err)
+}
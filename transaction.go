@@ -0,0 +1,155 @@
+package dnsupdate
+
+import (
+	"context"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// Update is a set of changes to a zone, sent in a single update message so
+// that they are applied atomically, and only if all the prerequisites are
+// met. It is created with Provider.NewUpdate.
+type Update struct {
+	p    *Provider
+	zone string
+	ops  []updateOp
+}
+
+type updateOpKind int
+
+const (
+	updateAdd updateOpKind = iota
+	updateDelete
+	updateRequire
+	updateRequireAbsent
+)
+
+type updateOp struct {
+	kind    updateOpKind
+	records []libdns.Record
+}
+
+// NewUpdate starts an update of a zone. Nothing is sent to the server until
+// Commit is called.
+func (p *Provider) NewUpdate(zone string) *Update {
+	return &Update{p: p, zone: zone}
+}
+
+// Add adds records to the zone.
+func (u *Update) Add(records ...libdns.Record) *Update {
+	u.ops = append(u.ops, updateOp{updateAdd, records})
+	return u
+}
+
+// Delete deletes records from the zone.
+func (u *Update) Delete(records ...libdns.Record) *Update {
+	u.ops = append(u.ops, updateOp{updateDelete, records})
+	return u
+}
+
+// Require makes the update conditional on the RRsets of the records
+// containing exactly these records. Otherwise, Commit fails with ErrNXRRSet.
+func (u *Update) Require(records ...libdns.Record) *Update {
+	u.ops = append(u.ops, updateOp{updateRequire, records})
+	return u
+}
+
+// RequireAbsent makes the update conditional on the zone not containing any
+// record with the name and type of each of the records, whose other fields
+// are ignored. Otherwise, Commit fails with ErrYXRRSet.
+func (u *Update) RequireAbsent(records ...libdns.Record) *Update {
+	u.ops = append(u.ops, updateOp{updateRequireAbsent, records})
+	return u
+}
+
+// Commit sends the update to the server. Unlike the other methods of
+// Provider, the update is never split into several messages.
+func (u *Update) Commit(ctx context.Context) (err error) {
+	p := u.p
+	ctx, span := p.startSpan(ctx, "Commit", u.zone)
+	defer func() { endSpan(span, err) }()
+
+	query, err := u.msg()
+	if err != nil {
+		return err
+	}
+	return p.sendAtomicUpdate(ctx, query)
+}
+
+// Validate checks the update without sending it: the records must be valid,
+// and the changes allowed by Scope, ProtectedRecords and MaxDeletes, so that
+// several updates can be checked before committing any of them. The zone is
+// transferred if MaxDeletes is set. The prerequisites are only checked by
+// the server when the update is committed.
+func (u *Update) Validate(ctx context.Context) error {
+	p := u.p
+	query, err := u.msg()
+	if err != nil {
+		return err
+	}
+	if err := p.checkChanges(ctx, query); err != nil {
+		return err
+	}
+	return p.checkMaxDeletes(ctx, query)
+}
+
+// msg builds the update message.
+func (u *Update) msg() (*dns.Msg, error) {
+	p := u.p
+	zone, err := p.resolveZone(u.zone)
+	if err != nil {
+		return nil, err
+	}
+
+	query := new(dns.Msg)
+	query.SetUpdate(zone)
+	for _, op := range u.ops {
+		var rrs []dns.RR
+		if op.kind == updateRequireAbsent {
+			rrs, err = marshalRRsets(zone, op.records)
+		} else {
+			rrs, err = marshalRecords(zone, op.records)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.kind {
+		case updateAdd:
+			p.applyTTLs(rrs)
+			query.Insert(rrs)
+		case updateDelete:
+			query.Remove(rrs)
+		case updateRequire:
+			query.Used(rrs)
+		case updateRequireAbsent:
+			query.RRsetNotUsed(rrs)
+		}
+	}
+	return query, nil
+}
+
+// sendAtomicUpdate sends an update message as is, without splitting it.
+func (p *Provider) sendAtomicUpdate(ctx context.Context, query *dns.Msg) error {
+	zone := query.Question[0].Name
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := p.checkChanges(ctx, query); err != nil {
+		return err
+	}
+	if err := p.checkMaxDeletes(ctx, query); err != nil {
+		return err
+	}
+	if !p.DryRun {
+		if err := p.confirmUpdate(ctx, query); err != nil {
+			return err
+		}
+	}
+	defer p.invalidateCache(zone)
+	return ignoreQueued(p.sendUpdate(ctx, query))
+}
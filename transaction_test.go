@@ -0,0 +1,80 @@
+package dnsupdate_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libdns/dnsupdate"
+	"github.com/libdns/libdns"
+)
+
+func TestUpdateRequireAbsent(t *testing.T) {
+	srv, p := newTestServer(t)
+	ctx := context.Background()
+
+	add := func() error {
+		return p.NewUpdate(testZone).
+			RequireAbsent(libdns.RR{Name: "www", Type: "CNAME"}).
+			Add(libdns.CNAME{Name: "www", TTL: time.Minute, Target: "web.example.org."}).
+			Commit(ctx)
+	}
+	if err := add(); err != nil {
+		t.Fatal(err)
+	}
+	if err := add(); !errors.Is(err, dnsupdate.ErrYXRRSet) {
+		t.Errorf("second Commit error = %v, want %v", err, dnsupdate.ErrYXRRSet)
+	}
+	if got := serverRecords(srv); len(got) != 1 {
+		t.Errorf("server records = %q, want a single CNAME", got)
+	}
+}
+
+func TestUpdateRequire(t *testing.T) {
+	srv, p := newTestServer(t)
+	ctx := context.Background()
+
+	old := libdns.TXT{Name: "a", TTL: time.Minute, Text: "1"}
+	if _, err := p.AppendRecords(ctx, testZone, []libdns.Record{old}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The records are swapped only if the RRset still holds the old one
+	swap := func(from, to libdns.TXT) error {
+		return p.NewUpdate(testZone).
+			Require(from).
+			Delete(from).
+			Add(to).
+			Commit(ctx)
+	}
+	other := libdns.TXT{Name: "a", TTL: time.Minute, Text: "2"}
+	if err := swap(other, old); !errors.Is(err, dnsupdate.ErrNXRRSet) {
+		t.Errorf("Commit error = %v, want %v", err, dnsupdate.ErrNXRRSet)
+	}
+	if err := swap(old, other); err != nil {
+		t.Fatal(err)
+	}
+	want := "a.example.org.\t60\tIN\tTXT\t\"2\""
+	if got := serverRecords(srv); len(got) != 1 || got[0] != want {
+		t.Errorf("server records = %q, want %q", got, want)
+	}
+}
+
+func TestUpdateValidate(t *testing.T) {
+	srv, p := newTestServer(t)
+	p.Scope = []string{"_acme-challenge.*"}
+	ctx := context.Background()
+
+	u := p.NewUpdate(testZone).Add(libdns.TXT{Name: "www", Text: "x"})
+	if err := u.Validate(ctx); !errors.Is(err, dnsupdate.ErrOutOfScope) {
+		t.Errorf("Validate error = %v, want %v", err, dnsupdate.ErrOutOfScope)
+	}
+	u = p.NewUpdate(testZone).Add(libdns.TXT{Name: "_acme-challenge", Text: "x"})
+	if err := u.Validate(ctx); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	if got := serverRecords(srv); len(got) != 0 {
+		t.Errorf("server holds %d records after validating, want none", len(got))
+	}
+}
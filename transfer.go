@@ -0,0 +1,334 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// errInvalidIXFR is returned when an incremental zone transfer can't be
+// applied to the known zone contents.
+var errInvalidIXFR = errors.New("invalid IXFR reply")
+
+// zoneSnapshot holds the records of a zone at a given SOA serial, which
+// incremental zone transfers are applied to. The SOA record comes first.
+type zoneSnapshot struct {
+	soa *dns.SOA
+	rrs []dns.RR
+}
+
+// transferZone fetches all the records of a zone, starting with its SOA
+// record, or reads them from its zone file if configured. If incremental transfers are enabled and the zone was already
+// transferred, only the changes since then are fetched.
+func (p *Provider) transferZone(ctx context.Context, zone string) ([]dns.RR, error) {
+	// Views have their own contents
+	view := callOptionsFrom(ctx).view != ""
+	if name := p.zoneFile(zone); name != "" && !view {
+		return readZoneFile(name, zone)
+	}
+	if !p.IXFR || view {
+		return p.axfr(ctx, zone)
+	}
+
+	key := dns.CanonicalName(zone)
+	p.mu.Lock()
+	snapshot := p.snapshots[key]
+	p.mu.Unlock()
+
+	var (
+		rrs []dns.RR
+		err error
+	)
+	if snapshot != nil {
+		rrs, err = p.ixfr(ctx, zone, snapshot)
+		// Fall back to a full transfer if the server doesn't support IXFR,
+		// or can't provide the changes since the known serial
+		var rcodeErr RcodeError
+		if errors.As(err, &rcodeErr) || errors.Is(err, errInvalidIXFR) {
+			rrs, err = nil, nil
+		}
+	}
+	if rrs == nil && err == nil {
+		rrs, err = p.axfr(ctx, zone)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if p.snapshots == nil {
+		p.snapshots = make(map[string]*zoneSnapshot)
+	}
+	p.snapshots[key] = &zoneSnapshot{soa: rrs[0].(*dns.SOA), rrs: rrs}
+	p.mu.Unlock()
+
+	return rrs, nil
+}
+
+// axfr performs a full zone transfer.
+func (p *Provider) axfr(ctx context.Context, zone string) ([]dns.RR, error) {
+	var query dns.Msg
+	query.SetAxfr(zone)
+
+	reply, err := p.roundTrip(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+
+	// The zone contents are enclosed in SOA records
+	answer := reply.Answer
+	if len(answer) < 2 || answer[0].Header().Rrtype != dns.TypeSOA || answer[len(answer)-1].Header().Rrtype != dns.TypeSOA {
+		return nil, fmt.Errorf("invalid AXFR reply for %v", zone)
+	}
+	return answer[:len(answer)-1], nil
+}
+
+// ixfr performs an incremental zone transfer, as defined in RFC 1995, and
+// applies the changes to the snapshot.
+func (p *Provider) ixfr(ctx context.Context, zone string, snapshot *zoneSnapshot) ([]dns.RR, error) {
+	var query dns.Msg
+	query.SetQuestion(zone, dns.TypeIXFR)
+	query.Ns = []dns.RR{snapshot.soa}
+
+	reply, err := p.roundTrip(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := reply.Answer
+	if len(answer) == 0 || answer[0].Header().Rrtype != dns.TypeSOA {
+		return nil, errInvalidIXFR
+	}
+	soa := answer[0].(*dns.SOA)
+
+	switch {
+	case len(answer) == 1:
+		// The zone didn't change
+		if soa.Serial != snapshot.soa.Serial {
+			return nil, errInvalidIXFR
+		}
+		return snapshot.rrs, nil
+	case answer[1].Header().Rrtype != dns.TypeSOA:
+		// The server replied with a full zone transfer instead
+		if answer[len(answer)-1].Header().Rrtype != dns.TypeSOA {
+			return nil, errInvalidIXFR
+		}
+		return answer[:len(answer)-1], nil
+	default:
+		return applyIXFR(snapshot, answer)
+	}
+}
+
+// applyIXFR applies the differences sequences of an incremental zone transfer
+// to a snapshot. Each sequence lists the deleted records, preceded by the old
+// SOA record, and the added records, preceded by the new SOA record.
+func applyIXFR(snapshot *zoneSnapshot, answer []dns.RR) ([]dns.RR, error) {
+	last := len(answer) - 1
+	if answer[last].Header().Rrtype != dns.TypeSOA || answer[1].(*dns.SOA).Serial != snapshot.soa.Serial {
+		return nil, errInvalidIXFR
+	}
+
+	rrs := make([]dns.RR, len(snapshot.rrs)-1)
+	copy(rrs, snapshot.rrs[1:])
+
+	i := 1
+	for i < last {
+		// Skip the old SOA record
+		for i++; i < last && answer[i].Header().Rrtype != dns.TypeSOA; i++ {
+			rrs = removeRR(rrs, answer[i])
+		}
+		if i == last {
+			return nil, errInvalidIXFR
+		}
+
+		// Skip the new SOA record
+		for i++; i < last && answer[i].Header().Rrtype != dns.TypeSOA; i++ {
+			rrs = append(rrs, answer[i])
+		}
+	}
+
+	return append([]dns.RR{answer[0]}, rrs...), nil
+}
+
+// exchangeTransfer performs a zone transfer over a stream connection. Unlike
+// other queries, the reply may span multiple messages, which are merged into
+// a single one.
+func (p *Provider) exchangeTransfer(ctx context.Context, network, addr string, query *dns.Msg, s signer) (*dns.Msg, error) {
+	buf, sig, err := packMsg(query, s)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	// dns.Conn takes care of framing messages on stream connections
+	co := &dns.Conn{Conn: conn}
+	conn.SetWriteDeadline(time.Now().Add(p.writeTimeout()))
+	if _, err := co.Write(buf); err != nil {
+		return nil, transferError(ctx, err)
+	}
+
+	// Streamed records are handed over as they arrive instead of being
+	// collected in the reply
+	handle, _ := ctx.Value(transferHandlerKey{}).(transferHandler)
+
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	end := newTransferEnd(query)
+	buf = make([]byte, dns.MaxMsgSize)
+	for first := true; ; first = false {
+		conn.SetReadDeadline(time.Now().Add(p.readTimeout()))
+		n, err := co.Read(buf)
+		if err != nil {
+			return nil, transferError(ctx, err)
+		}
+
+		var msg *dns.Msg
+		if first {
+			msg, err = unpackReply(buf[:n], s, sig)
+			if err == nil && msg.IsTsig() != nil {
+				sig = msg.IsTsig().MAC
+			}
+		} else {
+			msg, err = unpackTransferMsg(buf[:n], s, &sig)
+		}
+		if err != nil {
+			return nil, err
+		} else if msg.Id != query.Id {
+			return nil, dns.ErrId
+		}
+
+		// The server fails the transfer with the rcode of a message, the
+		// first one being returned as is
+		if msg.Rcode != dns.RcodeSuccess && first {
+			return msg, nil
+		} else if msg.Rcode != dns.RcodeSuccess {
+			reply.Rcode = msg.Rcode
+			return reply, nil
+		}
+
+		done, err := end.done(msg.Answer)
+		if err != nil {
+			return nil, err
+		}
+		if handle == nil {
+			reply.Answer = append(reply.Answer, msg.Answer...)
+		} else if !handle(msg.Answer) {
+			return reply, nil
+		}
+		if done {
+			return reply, nil
+		}
+	}
+}
+
+// transferError returns the error of a failed exchange of a zone transfer,
+// which is the error of the context if it was canceled.
+func transferError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// transferEnd detects the last message of a zone transfer, since the server
+// doesn't close the connection after it. Full zone transfers end with the
+// SOA record they start with. Incremental zone transfers end with the third
+// occurrence of the SOA record of the new serial, or the second one if the
+// server sends the full zone instead, or with it alone if the zone didn't
+// change.
+type transferEnd struct {
+	ixfr   bool
+	serial uint32 // serial of the IXFR query
+
+	first       *dns.SOA
+	incremental bool
+	repeats     int
+}
+
+func newTransferEnd(query *dns.Msg) *transferEnd {
+	end := new(transferEnd)
+	if query.Question[0].Qtype == dns.TypeIXFR && len(query.Ns) > 0 {
+		if soa, ok := query.Ns[0].(*dns.SOA); ok {
+			end.ixfr, end.serial = true, soa.Serial
+		}
+	}
+	return end
+}
+
+// done reports whether the records of a message end the transfer.
+func (end *transferEnd) done(rrs []dns.RR) (bool, error) {
+	for _, rr := range rrs {
+		soa, ok := rr.(*dns.SOA)
+		if end.first == nil {
+			if !ok {
+				return false, fmt.Errorf("invalid zone transfer reply: %w", dns.ErrSoa)
+			}
+			end.first = soa
+			if end.ixfr && !serialGreater(soa.Serial, end.serial) {
+				return true, nil
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		if end.ixfr && soa.Serial != end.first.Serial {
+			// Only incremental transfers hold SOA records of older serials
+			end.incremental = true
+			continue
+		}
+		end.repeats++
+		if !end.incremental || end.repeats == 2 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// unpackTransferMsg unpacks a message of a zone transfer following the first
+// one. TSIG signatures of these messages cover the MAC of the previous
+// signed message, whose MAC is updated, and only the timers of their TSIG
+// record (RFC 8945 section 5.3.1). Up to 99 messages may be left unsigned
+// in between.
+func unpackTransferMsg(buf []byte, s signer, prevMAC *string) (*dns.Msg, error) {
+	key, ok := s.(*tsigKey)
+	if !ok {
+		return unpackReply(buf, s, *prevMAC)
+	}
+
+	var msg dns.Msg
+	if err := msg.Unpack(buf); err != nil {
+		return nil, err
+	}
+	if t := msg.IsTsig(); t != nil {
+		if err := key.checkTime(dns.TsigVerifyWithProvider(buf, key.provider, *prevMAC, true), t); err != nil {
+			return nil, err
+		}
+		*prevMAC = t.MAC
+	}
+	return &msg, nil
+}
+
+// removeRR removes a record from a list of records, regardless of its TTL.
+func removeRR(rrs []dns.RR, rr dns.RR) []dns.RR {
+	for i, other := range rrs {
+		if dns.IsDuplicate(other, rr) {
+			return slices.Delete(rrs, i, i+1)
+		}
+	}
+	return rrs
+}
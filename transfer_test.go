@@ -0,0 +1,148 @@
+package dnsupdate
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func testSOA(serial uint32) dns.RR {
+	return testRR(fmt.Sprintf("example.org. 3600 IN SOA ns.example.org. admin.example.org. %d 3600 600 86400 60", serial))
+}
+
+func testRR(s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		panic(err)
+	}
+	return rr
+}
+
+func TestApplyIXFR(t *testing.T) {
+	var (
+		a1 = testRR("a.example.org. 60 IN A 192.0.2.1")
+		a2 = testRR("a.example.org. 60 IN A 192.0.2.2")
+		b  = testRR("b.example.org. 60 IN TXT \"b\"")
+		c  = testRR("c.example.org. 60 IN TXT \"c\"")
+	)
+	snapshot := &zoneSnapshot{soa: testSOA(1).(*dns.SOA), rrs: []dns.RR{testSOA(1), a1, b}}
+
+	for _, test := range []struct {
+		name   string
+		answer []dns.RR
+		want   []dns.RR
+		err    error
+	}{
+		{
+			name:   "single sequence",
+			answer: []dns.RR{testSOA(2), testSOA(1), a1, testSOA(2), a2, testSOA(2)},
+			want:   []dns.RR{testSOA(2), b, a2},
+		},
+		{
+			name:   "deletions only",
+			answer: []dns.RR{testSOA(2), testSOA(1), a1, b, testSOA(2), testSOA(2)},
+			want:   []dns.RR{testSOA(2)},
+		},
+		{
+			name:   "additions only",
+			answer: []dns.RR{testSOA(2), testSOA(1), testSOA(2), c, testSOA(2)},
+			want:   []dns.RR{testSOA(2), a1, b, c},
+		},
+		{
+			name: "multiple sequences",
+			answer: []dns.RR{
+				testSOA(4),
+				testSOA(1), a1, testSOA(2), a2,
+				testSOA(2), b, testSOA(3), c,
+				testSOA(3), c, testSOA(4), b,
+				testSOA(4),
+			},
+			want: []dns.RR{testSOA(4), a2, b},
+		},
+		{
+			name:   "deleted record with another TTL",
+			answer: []dns.RR{testSOA(2), testSOA(1), testRR("a.example.org. 300 IN A 192.0.2.1"), testSOA(2), testSOA(2)},
+			want:   []dns.RR{testSOA(2), b},
+		},
+		{
+			name:   "other old serial",
+			answer: []dns.RR{testSOA(3), testSOA(2), a1, testSOA(3), testSOA(3)},
+			err:    errInvalidIXFR,
+		},
+		{
+			name:   "missing final SOA",
+			answer: []dns.RR{testSOA(2), testSOA(1), a1, testSOA(2), a2},
+			err:    errInvalidIXFR,
+		},
+		{
+			name:   "truncated sequence",
+			answer: []dns.RR{testSOA(2), testSOA(1), a1, testSOA(2)},
+			err:    errInvalidIXFR,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rrs, err := applyIXFR(snapshot, test.answer)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("applyIXFR error = %v, want %v", err, test.err)
+			}
+			if len(rrs) != len(test.want) {
+				t.Fatalf("applyIXFR = %v, want %v", rrs, test.want)
+			}
+			for i := range rrs {
+				if rrs[i].String() != test.want[i].String() {
+					t.Fatalf("applyIXFR = %v, want %v", rrs, test.want)
+				}
+			}
+		})
+	}
+
+	// The snapshot is left as is
+	if len(snapshot.rrs) != 3 || snapshot.rrs[1] != a1 || snapshot.rrs[2] != b {
+		t.Errorf("applyIXFR changed the snapshot: %v", snapshot.rrs)
+	}
+}
+
+func TestTransferEnd(t *testing.T) {
+	a := testRR("a.example.org. 60 IN A 192.0.2.1")
+	axfr := new(dns.Msg).SetAxfr("example.org.")
+	ixfr := new(dns.Msg).SetQuestion("example.org.", dns.TypeIXFR)
+	ixfr.Ns = []dns.RR{testSOA(1)}
+
+	for _, test := range []struct {
+		name  string
+		query *dns.Msg
+		msgs  [][]dns.RR
+		done  int // index of the message ending the transfer, or -1
+	}{
+		{"AXFR", axfr, [][]dns.RR{{testSOA(2), a, testSOA(2)}}, 0},
+		{"AXFR over several messages", axfr, [][]dns.RR{{testSOA(2)}, {a}, {a, testSOA(2)}}, 2},
+		{"unfinished AXFR", axfr, [][]dns.RR{{testSOA(2), a}}, -1},
+		{"IXFR without changes", ixfr, [][]dns.RR{{testSOA(1)}}, 0},
+		{"IXFR", ixfr, [][]dns.RR{{testSOA(3), testSOA(1), a, testSOA(2), testSOA(2), testSOA(3), a, testSOA(3)}}, 0},
+		{"IXFR over several messages", ixfr, [][]dns.RR{{testSOA(2), testSOA(1)}, {a, testSOA(2)}, {a}, {testSOA(2)}}, 3},
+		{"IXFR falling back to AXFR", ixfr, [][]dns.RR{{testSOA(2), a}, {a, testSOA(2)}}, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			end := newTransferEnd(test.query)
+			for i, rrs := range test.msgs {
+				done, err := end.done(rrs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if done != (i == test.done) {
+					t.Fatalf("done = %v after message %d", done, i)
+				}
+				if done {
+					return
+				}
+			}
+		})
+	}
+
+	// Transfers start with a SOA record
+	if _, err := newTransferEnd(axfr).done([]dns.RR{a}); !errors.Is(err, dns.ErrSoa) {
+		t.Errorf("done error = %v, want %v", err, dns.ErrSoa)
+	}
+}
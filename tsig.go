@@ -0,0 +1,412 @@
+package dnsupdate
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// SecretSource provides TSIG secrets at signing time, for instance from an
+// external secret store.
+type SecretSource interface {
+	// TSIGSecret returns the algorithm and the base64-encoded secret of a TSIG
+	// key. An empty algorithm means the algorithm configured in the Provider.
+	TSIGSecret(ctx context.Context, keyName string) (algorithm, secret string, err error)
+}
+
+// SecretSourceFunc is an adapter to allow the use of ordinary functions as
+// SecretSource.
+type SecretSourceFunc func(ctx context.Context, keyName string) (algorithm, secret string, err error)
+
+// TSIGSecret calls f(ctx, keyName).
+func (f SecretSourceFunc) TSIGSecret(ctx context.Context, keyName string) (algorithm, secret string, err error) {
+	return f(ctx, keyName)
+}
+
+// TSIGKey configures a TSIG key. The secret is either set directly
+// (base64-encoded), read from a file, or read from an environment variable.
+type TSIGKey struct {
+	Name       string `json:"name,omitempty"`
+	Algorithm  string `json:"algorithm,omitempty"`
+	Secret     string `json:"secret,omitempty"`
+	SecretFile string `json:"secret_file,omitempty"`
+	SecretEnv  string `json:"secret_env,omitempty"`
+}
+
+// tsigKeyConfig returns the configuration of the TSIG key used to sign
+// messages for a zone, or nil if no key is configured.
+func (p *Provider) tsigKeyConfig(zone string) *TSIGKey {
+	// Use the key of the closest enclosing zone, if any, preferring Zones
+	// over the deprecated ZoneKeys for the same zone
+	zone = dns.CanonicalName(zone)
+	var (
+		key   TSIGKey
+		found bool
+		best  string
+	)
+	for name, c := range p.Zones {
+		name = dns.CanonicalName(name)
+		if c.Key != nil && dns.IsSubDomain(name, zone) && (!found || len(name) > len(best)) {
+			key, found, best = *c.Key, true, name
+		}
+	}
+	for name, k := range p.ZoneKeys {
+		name = dns.CanonicalName(name)
+		if dns.IsSubDomain(name, zone) && (!found || len(name) > len(best)) {
+			key, found, best = k, true, name
+		}
+	}
+	if found {
+		return &key
+	}
+
+	if p.TSIGKeyName == "" {
+		return nil
+	}
+	return p.defaultTSIGKeyConfig()
+}
+
+// defaultTSIGKeyConfig returns the configuration of the TSIG key set in the
+// TSIG* fields.
+func (p *Provider) defaultTSIGKeyConfig() *TSIGKey {
+	return &TSIGKey{
+		Name:       p.TSIGKeyName,
+		Algorithm:  p.TSIGAlgorithm,
+		Secret:     p.TSIGSecret,
+		SecretFile: p.TSIGSecretFile,
+		SecretEnv:  p.TSIGSecretEnv,
+	}
+}
+
+// tsigKey returns the TSIG key used to sign messages for a zone, or nil if
+// no key is configured.
+func (p *Provider) tsigKey(ctx context.Context, zone string) (*tsigKey, error) {
+	config := p.tsigKeyConfig(zone)
+	override, err := p.keyOverride(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if override != nil {
+		config = override
+	}
+	if config == nil {
+		return nil, nil
+	}
+	return p.loadTSIGKey(ctx, config)
+}
+
+// loadTSIGKey loads the secret of a TSIG key, unless the MACs are computed
+// by the configured TSIGProvider.
+func (p *Provider) loadTSIGKey(ctx context.Context, config *TSIGKey) (*tsigKey, error) {
+	if p.TSIGProvider != nil {
+		algorithm, err := normalizeTSIGAlgorithm(config.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		return &tsigKey{
+			name:      dns.CanonicalName(config.Name),
+			algorithm: algorithm,
+			fudge:     p.tsigFudge(),
+			provider:  p.TSIGProvider,
+		}, nil
+	}
+
+	algorithm := config.Algorithm
+	var (
+		secret string
+		err    error
+	)
+	if p.SecretSource != nil {
+		var sourceAlgorithm string
+		sourceAlgorithm, secret, err = p.SecretSource.TSIGSecret(ctx, config.Name)
+		if sourceAlgorithm != "" {
+			algorithm = sourceAlgorithm
+		}
+	} else {
+		secret, err = config.secret()
+	}
+	if err != nil {
+		return nil, err
+	}
+	rawSecret, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TSIG secret: %w", err)
+	}
+
+	algorithm, err = normalizeTSIGAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tsigKey{
+		name:      dns.CanonicalName(config.Name),
+		algorithm: algorithm,
+		fudge:     p.tsigFudge(),
+		provider:  hmacProvider(rawSecret),
+	}, nil
+}
+
+// retryTSIG sends a query again when the server rejected its TSIG
+// signature in a way which can be fixed: once with a corrected signing time
+// after BADTIME, and with each of the fallback keys after BADKEY.
+func (p *Provider) retryTSIG(ctx context.Context, addr string, query, reply *dns.Msg, key *tsigKey) (*dns.Msg, error) {
+	if errors.Is(replyTSIGError(reply), ErrBadTime) && key.serverTime != 0 {
+		p.setClockOffset(addr, key.serverTime-time.Now().Unix())
+
+		retry := *key
+		retry.offset = p.clockOffset(addr)
+		retry.serverTime = 0
+		var err error
+		reply, err = p.observedExchange(ctx, addr, query, &retry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if errors.Is(replyTSIGError(reply), ErrBadKey) {
+		return p.exchangeFallbackKeys(ctx, addr, query, reply)
+	}
+	return reply, nil
+}
+
+// clockOffset returns the difference between the clocks of a server and of
+// the client, in seconds, as learned from BADTIME replies.
+func (p *Provider) clockOffset(addr string) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.clockOffsets[addr]
+}
+
+func (p *Provider) setClockOffset(addr string, offset int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.clockOffsets == nil {
+		p.clockOffsets = make(map[string]int64)
+	}
+	p.clockOffsets[addr] = offset
+}
+
+// exchangeFallbackKeys sends a query signed with each of the fallback TSIG
+// keys in turn, after the server rejected the key of the zone with BADKEY,
+// and returns the first reply not rejecting the key.
+func (p *Provider) exchangeFallbackKeys(ctx context.Context, addr string, query, reply *dns.Msg) (*dns.Msg, error) {
+	for _, config := range p.FallbackTSIGKeys {
+		key, err := p.loadTSIGKey(ctx, &config)
+		if err != nil {
+			return nil, err
+		}
+		key.offset = p.clockOffset(addr)
+
+		reply, err = p.observedExchange(ctx, addr, query, key)
+		if err != nil || !errors.Is(replyTSIGError(reply), ErrBadKey) {
+			return reply, err
+		}
+	}
+	return reply, nil
+}
+
+// tsigAlgorithms lists the supported TSIG algorithms.
+var tsigAlgorithms = []string{
+	dns.HmacSHA1,
+	dns.HmacSHA224,
+	dns.HmacSHA256,
+	dns.HmacSHA384,
+	dns.HmacSHA512,
+}
+
+// normalizeTSIGAlgorithm returns the canonical name of a TSIG algorithm,
+// accepting names in any case and with or without the trailing dot. It
+// defaults to HMAC-SHA256.
+func normalizeTSIGAlgorithm(name string) (string, error) {
+	if name == "" {
+		return dns.HmacSHA256, nil
+	}
+
+	canonical := dns.CanonicalName(name)
+	for _, algorithm := range tsigAlgorithms {
+		if canonical == algorithm {
+			return algorithm, nil
+		}
+	}
+
+	// Help with common mistakes, such as "sha256" instead of "hmac-sha256"
+	for _, algorithm := range tsigAlgorithms {
+		if "hmac-"+canonical == algorithm {
+			return "", fmt.Errorf("unsupported TSIG algorithm %q, did you mean %q?", name, strings.TrimSuffix(algorithm, "."))
+		}
+	}
+	return "", fmt.Errorf("unsupported TSIG algorithm %q, expected one of hmac-sha1, hmac-sha224, hmac-sha256, hmac-sha384 or hmac-sha512", name)
+}
+
+// secret returns the base64-encoded TSIG secret. The secret file is read
+// every time so that rotated secrets are picked up.
+func (key *TSIGKey) secret() (string, error) {
+	switch {
+	case key.SecretFile != "":
+		b, err := os.ReadFile(key.SecretFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read TSIG secret: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	case key.SecretEnv != "":
+		secret, ok := os.LookupEnv(key.SecretEnv)
+		if !ok {
+			return "", fmt.Errorf("TSIG secret environment variable %v is not set", key.SecretEnv)
+		}
+		return strings.TrimSpace(secret), nil
+	case key.Secret != "":
+		return key.Secret, nil
+	default:
+		return "", fmt.Errorf("missing secret for TSIG key %v", key.Name)
+	}
+}
+
+// defaultTSIGFudge is the default time difference allowed between the client
+// and the server clocks, as recommended by RFC 8945.
+const defaultTSIGFudge = 300 * time.Second
+
+func (p *Provider) tsigFudge() uint16 {
+	if p.TSIGFudge > 0 {
+		return uint16(min(p.TSIGFudge/time.Second, math.MaxUint16))
+	}
+	return uint16(defaultTSIGFudge / time.Second)
+}
+
+type tsigKey struct {
+	name      string
+	algorithm string
+	fudge     uint16
+	provider  dns.TsigProvider
+
+	// Difference between the clocks of the server and of the client, in
+	// seconds, added to the signing time.
+	offset int64
+	// Time of the server reported in an authenticated BADTIME reply, set by
+	// verify. Each exchange must use its own copy of the key.
+	serverTime int64
+}
+
+func (key *tsigKey) sign(msg *dns.Msg) (buf []byte, mac string, err error) {
+	msg = msg.Copy()
+	msg.SetTsig(key.name, key.algorithm, key.fudge, key.now())
+	return dns.TsigGenerateWithProvider(msg, key.provider, "", false)
+}
+
+// now returns the signing time, adjusted to the clock of the server.
+func (key *tsigKey) now() int64 {
+	return time.Now().Unix() + key.offset
+}
+
+func (key *tsigKey) verify(buf []byte, reply *dns.Msg, requestMAC string) error {
+	t := reply.IsTsig()
+	if t != nil && t.Error == dns.RcodeBadTime && t.OtherLen == 6 && key.verifyMAC(reply, requestMAC) {
+		if serverTime, err := strconv.ParseInt(t.OtherData, 16, 64); err == nil {
+			key.serverTime = serverTime
+		}
+	}
+
+	// Servers may only leave replies to signed queries unsigned when they
+	// can't process the signature, as allowed by RFC 8945 section 5.3, so
+	// that a spoofed success isn't taken for an authenticated reply
+	if t == nil {
+		switch reply.Rcode {
+		case dns.RcodeFormatError, dns.RcodeNotImplemented, dns.RcodeNotAuth:
+			return nil
+		}
+		return fmt.Errorf("reply to a signed query isn't signed: %w", dns.ErrNoSig)
+	}
+
+	// Replies reporting a TSIG error are not signed. miekg/dns can't verify
+	// NOTAUTH replies, which only lead to an error anyway.
+	if t.Error != dns.RcodeSuccess || reply.Rcode == dns.RcodeNotAuth {
+		return nil
+	}
+
+	return key.checkTime(dns.TsigVerifyWithProvider(buf, key.provider, requestMAC, false), t)
+}
+
+// checkTime ignores the error about the signing time of a verified message
+// if the time is within the fudge of the clock of the server, when it's
+// known to differ. The signing time is only checked once the MAC is.
+func (key *tsigKey) checkTime(err error, t *dns.TSIG) error {
+	if errors.Is(err, dns.ErrTime) && key.offset != 0 {
+		diff := int64(t.TimeSigned) - key.now()
+		if max(diff, -diff) <= int64(t.Fudge) {
+			return nil
+		}
+	}
+	return err
+}
+
+// verifyMAC checks the MAC of a reply regardless of its rcode and signing
+// time, by signing it again, since miekg/dns refuses to verify NOTAUTH
+// replies.
+func (key *tsigKey) verifyMAC(reply *dns.Msg, requestMAC string) bool {
+	mac := reply.IsTsig().MAC
+	_, expected, err := dns.TsigGenerateWithProvider(reply.Copy(), key.provider, requestMAC, false)
+	return err == nil && mac != "" && strings.EqualFold(mac, expected)
+}
+
+// hmacProvider implements dns.TsigProvider for HMAC-based TSIG algorithms,
+// with a raw secret.
+type hmacProvider []byte
+
+func (secret hmacProvider) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	var h func() hash.Hash
+	switch dns.CanonicalName(t.Algorithm) {
+	case dns.HmacSHA1:
+		h = sha1.New
+	case dns.HmacSHA224:
+		h = sha256.New224
+	case dns.HmacSHA256:
+		h = sha256.New
+	case dns.HmacSHA384:
+		h = sha512.New384
+	case dns.HmacSHA512:
+		h = sha512.New
+	default:
+		return nil, dns.ErrKeyAlg
+	}
+
+	mac := hmac.New(h, secret)
+	mac.Write(msg)
+	return mac.Sum(nil), nil
+}
+
+func (secret hmacProvider) Verify(msg []byte, t *dns.TSIG) error {
+	expected, err := secret.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, mac) {
+		return dns.ErrSig
+	}
+	return nil
+}
+
+// replyTSIGError returns the TSIG error reported by the server in a reply,
+// if any.
+func replyTSIGError(reply *dns.Msg) error {
+	if t := reply.IsTsig(); t != nil && t.Error != dns.RcodeSuccess {
+		return fmt.Errorf("server rejected TSIG signature: %w", RcodeError(t.Error))
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package dnsupdate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestTSIGVerify(t *testing.T) {
+	key := &tsigKey{
+		name:      "key.",
+		algorithm: dns.HmacSHA256,
+		fudge:     300,
+		provider:  hmacProvider("secretsecret"),
+	}
+	var query dns.Msg
+	query.SetUpdate("example.org.")
+	_, requestMAC, err := key.sign(&query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		rcode  int
+		signed bool
+		err    error
+	}{
+		{"signed", dns.RcodeSuccess, true, nil},
+		{"signed error", dns.RcodeRefused, true, nil},
+		{"unsigned", dns.RcodeSuccess, false, dns.ErrNoSig},
+		{"unsigned refused", dns.RcodeRefused, false, dns.ErrNoSig},
+		{"unsigned formerr", dns.RcodeFormatError, false, nil},
+		{"unsigned notimp", dns.RcodeNotImplemented, false, nil},
+		{"unsigned notauth", dns.RcodeNotAuth, false, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var reply dns.Msg
+			reply.SetRcode(&query, test.rcode)
+			var buf []byte
+			if test.signed {
+				reply.SetTsig(key.name, key.algorithm, key.fudge, key.now())
+				buf, _, err = dns.TsigGenerateWithProvider(&reply, key.provider, requestMAC, false)
+			} else {
+				buf, err = reply.Pack()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := unpackReply(buf, key, requestMAC); !errors.Is(err, test.err) {
+				t.Errorf("unpackReply error = %v, want %v", err, test.err)
+			}
+		})
+	}
+
+	// Replies signed with another key are rejected
+	var reply dns.Msg
+	reply.SetReply(&query)
+	reply.SetTsig(key.name, key.algorithm, key.fudge, key.now())
+	buf, _, err := dns.TsigGenerateWithProvider(&reply, hmacProvider("othersecret"), requestMAC, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unpackReply(buf, key, requestMAC); err == nil {
+		t.Error("unpackReply accepted a reply signed with another key")
+	}
+}
+
+func TestNormalizeTSIGAlgorithm(t *testing.T) {
+	for _, test := range []struct {
+		name, algorithm, err string
+	}{
+		{"", dns.HmacSHA256, ""},
+		{"hmac-sha1", dns.HmacSHA1, ""},
+		{"hmac-sha224.", dns.HmacSHA224, ""},
+		{"hmac-sha256", dns.HmacSHA256, ""},
+		{"HMAC-SHA384", dns.HmacSHA384, ""},
+		{"Hmac-Sha512.", dns.HmacSHA512, ""},
+		{"sha256", "", `unsupported TSIG algorithm "sha256", did you mean "hmac-sha256"?`},
+		{"SHA512.", "", `unsupported TSIG algorithm "SHA512.", did you mean "hmac-sha512"?`},
+		{"hmac-md5", "", `unsupported TSIG algorithm "hmac-md5", expected one of hmac-sha1, hmac-sha224, hmac-sha256, hmac-sha384 or hmac-sha512`},
+		{"gss-tsig", "", `unsupported TSIG algorithm "gss-tsig", expected one of hmac-sha1, hmac-sha224, hmac-sha256, hmac-sha384 or hmac-sha512`},
+	} {
+		algorithm, err := normalizeTSIGAlgorithm(test.name)
+		switch {
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("normalizeTSIGAlgorithm(%q) error = %v, want %q", test.name, err, test.err)
+		case test.err == "" && err != nil:
+			t.Errorf("normalizeTSIGAlgorithm(%q): %v", test.name, err)
+		case algorithm != test.algorithm:
+			t.Errorf("normalizeTSIGAlgorithm(%q) = %q, want %q", test.name, algorithm, test.algorithm)
+		}
+	}
+}
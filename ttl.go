@@ -0,0 +1,48 @@
+package dnsupdate
+
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// applyTTLs sets the TTL of RRs built without one to DefaultTTL, and clamps
+// TTLs between MinTTL and MaxTTL.
+func (p *Provider) applyTTLs(rrs []dns.RR) {
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		ttl := time.Duration(hdr.Ttl) * time.Second
+		if ttl == 0 {
+			ttl = p.DefaultTTL
+		}
+		if p.MinTTL > 0 {
+			ttl = max(ttl, p.MinTTL)
+		}
+		if p.MaxTTL > 0 {
+			ttl = min(ttl, p.MaxTTL)
+		}
+		hdr.Ttl = uint32(min(ttl, maxTTL) / time.Second)
+	}
+}
+
+// keepTTLs sets the TTL of RRs built without one to the TTL of their
+// existing RRset in the zone, if any.
+func (p *Provider) keepTTLs(ctx context.Context, zone string, rrs []dns.RR) error {
+	current, err := p.transferZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+
+	ttls := make(map[rrsetKey]uint32)
+	for _, rr := range current {
+		ttls[rrsetKeyOf(rr)] = rr.Header().Ttl
+	}
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if ttl, ok := ttls[rrsetKeyOf(rr)]; ok && hdr.Ttl == 0 {
+			hdr.Ttl = ttl
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package dnsupdate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// maxTXTStringLen is the maximum length of a character string in a TXT
+// record, see RFC 1035 section 3.3.
+const maxTXTStringLen = 255
+
+// marshalTXT converts a TXT record to a RR. The text is escaped, and split
+// into multiple character strings if it is too long.
+func marshalTXT(fqdn string, record libdns.TXT) dns.RR {
+	txt := &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   fqdn,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    uint32(record.TTL / time.Second),
+		},
+	}
+
+	text := record.Text
+	for len(text) > maxTXTStringLen {
+		txt.Txt = append(txt.Txt, escapeString(text[:maxTXTStringLen]))
+		text = text[maxTXTStringLen:]
+	}
+	txt.Txt = append(txt.Txt, escapeString(text))
+	return txt
+}
+
+// unmarshalTXT converts a TXT RR to a record, joining its character strings.
+func unmarshalTXT(rr *dns.TXT) libdns.TXT {
+	var text strings.Builder
+	for _, s := range rr.Txt {
+		text.WriteString(unescapeString(s))
+	}
+
+	return libdns.TXT{
+		Name: rr.Hdr.Name,
+		TTL:  time.Duration(rr.Hdr.Ttl) * time.Second,
+		Text: text.String(),
+	}
+}
+
+// escapeString escapes a character string in the format expected by
+// miekg/dns: quotes and backslashes are prefixed with a backslash, and
+// non-printable bytes are written as "\DDD".
+func escapeString(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// unescapeString decodes the escape sequences of a character string, either
+// "\X" or "\DDD".
+func unescapeString(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 10, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i+1])
+		i++
+	}
+	return b.String()
+}
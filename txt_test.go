@@ -0,0 +1,100 @@
+package dnsupdate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+func TestTXTRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		text    string
+		strings int
+	}{
+		{"empty", "", 1},
+		{"plain", "v=spf1 -all", 1},
+		{"quotes", `say "hello"`, 1},
+		{"backslashes", `C:\path\`, 1},
+		{"semicolon", "a; b", 1},
+		{"escape sequence", `\065`, 1},
+		{"control characters", "a\tb\nc\x00", 1},
+		{"utf-8", "héllo wörld", 1},
+		{"255 bytes", strings.Repeat("a", 255), 1},
+		{"256 bytes", strings.Repeat("a", 256), 2},
+		{"long", strings.Repeat("0123456789", 100), 4},
+		{"long quotes", strings.Repeat(`"`, 300), 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rr := marshalTXT("www.example.org.", libdns.TXT{Name: "www", Text: test.text}).(*dns.TXT)
+
+			// Pack the record to check that the character strings fit
+			msg := new(dns.Msg)
+			msg.Answer = []dns.RR{rr}
+			buf, err := msg.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := msg.Unpack(buf); err != nil {
+				t.Fatal(err)
+			}
+			got := msg.Answer[0].(*dns.TXT)
+			if len(got.Txt) != test.strings {
+				t.Errorf("record has %d character strings, want %d", len(got.Txt), test.strings)
+			}
+			if text := unmarshalTXT(got).Text; text != test.text {
+				t.Errorf("text after a round trip = %q, want %q", text, test.text)
+			}
+
+			// The presentation format is parsed back to the same text. The
+			// parser of miekg/dns splits long strings before unescaping
+			// them, so only short ones are checked
+			if test.strings > 1 {
+				return
+			}
+			parsed, err := dns.NewRR(rr.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text := unmarshalTXT(parsed.(*dns.TXT)).Text; text != test.text {
+				t.Errorf("text after parsing %q = %q, want %q", rr.String(), text, test.text)
+			}
+		})
+	}
+}
+
+func TestEscapeString(t *testing.T) {
+	for _, test := range []struct {
+		s, escaped string
+	}{
+		{"abc", "abc"},
+		{`a"b`, `a\"b`},
+		{`a\b`, `a\\b`},
+		{"a\x00b", `a\000b`},
+		{"\xff", `\255`},
+		{"a b;c", "a b;c"},
+	} {
+		if escaped := escapeString(test.s); escaped != test.escaped {
+			t.Errorf("escapeString(%q) = %q, want %q", test.s, escaped, test.escaped)
+		}
+		if s := unescapeString(test.escaped); s != test.s {
+			t.Errorf("unescapeString(%q) = %q, want %q", test.escaped, s, test.s)
+		}
+	}
+
+	// Incomplete decimal escapes only escape their first digit
+	for _, test := range []struct {
+		escaped, s string
+	}{
+		{`a\`, `a\`},
+		{`\1`, "1"},
+		{`\12`, "12"},
+		{`\1234`, "{4"},
+	} {
+		if s := unescapeString(test.escaped); s != test.s {
+			t.Errorf("unescapeString(%q) = %q, want %q", test.escaped, s, test.s)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// maxTTL is the largest TTL allowed, see RFC 2181 section 8.
+const maxTTL = math.MaxInt32 * time.Second
+
+// validateRecord checks a record before building its RR, so that mistakes
+// are reported with the record they come from rather than as a parse error
+// or a FORMERR from the server.
+func validateRecord(fqdn string, r libdns.RR) error {
+	// Labels are limited to 63 bytes, and names to 255 bytes
+	if _, ok := dns.IsDomainName(fqdn); !ok {
+		return fmt.Errorf("invalid name %q", fqdn)
+	}
+
+	if _, ok := dns.StringToType[r.Type]; !ok {
+		n, ok := strings.CutPrefix(r.Type, "TYPE")
+		if _, err := strconv.ParseUint(n, 10, 16); !ok || err != nil {
+			return fmt.Errorf("unknown record type %q", r.Type)
+		}
+	}
+
+	if r.TTL < 0 || r.TTL > maxTTL {
+		return fmt.Errorf("TTL %v out of range", r.TTL)
+	}
+	return nil
+}
+
+// Validate checks the configuration of the provider: the syntax of the
+// server addresses, the keys used to sign messages, and whether the servers
+// reply to queries. All the problems found are reported, so that
+// misconfigurations can be caught early, such as when starting a service.
+func (p *Provider) Validate(ctx context.Context) error {
+	var errs []error
+	for _, addr := range p.servers() {
+		if err := validateAddr(addr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for zone := range p.Zones {
+		for _, addr := range p.zoneServers(zone) {
+			if err := validateAddr(addr); err != nil {
+				errs = append(errs, fmt.Errorf("zone %v: %w", zone, err))
+			}
+		}
+	}
+	for name, view := range p.Views {
+		for _, addr := range view.servers() {
+			if err := validateAddr(addr); err != nil {
+				errs = append(errs, fmt.Errorf("view %v: %w", name, err))
+			}
+		}
+	}
+	if _, err := p.localAddr("tcp"); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := p.familyNetworks("tcp"); err != nil {
+		errs = append(errs, err)
+	}
+	for _, pattern := range p.Scope {
+		if _, ok := dns.IsDomainName(pattern); !ok || pattern == "" {
+			errs = append(errs, fmt.Errorf("invalid scope pattern %q", pattern))
+		}
+	}
+	for _, pattern := range p.ProtectedRecords {
+		if _, err := parseProtectedPattern(pattern, "."); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if p.MaxDeletes != "" {
+		if _, err := p.maxDeletes(0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, t := range p.LookupTypes {
+		if _, ok := dns.StringToType[t]; !ok {
+			errs = append(errs, fmt.Errorf("unknown lookup record type %q", t))
+		}
+	}
+	if _, err := p.excludedRR("."); err != nil {
+		errs = append(errs, err)
+	}
+	for zone, name := range p.ZoneFiles {
+		if _, err := readZoneFile(name, dns.Fqdn(zone)); err != nil {
+			errs = append(errs, fmt.Errorf("zone file of %v: %w", zone, err))
+		}
+	}
+	if p.ReplicationPolicy != "" {
+		if _, err := p.replicationQuorum(0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if p.MinTTL > 0 && p.MaxTTL > 0 && p.MinTTL > p.MaxTTL {
+		errs = append(errs, fmt.Errorf("minimum TTL %v greater than maximum TTL %v", p.MinTTL, p.MaxTTL))
+	}
+	if _, err := p.tlsConfig(""); err != nil {
+		errs = append(errs, err)
+	}
+	if p.TLSCertFile != "" {
+		if _, err := p.clientCertificate(nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, p.validateKeys(ctx)...)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	// Any reply, even an error, shows that the server is reachable
+	for _, addr := range p.servers() {
+		var query dns.Msg
+		query.SetQuestion(".", dns.TypeSOA)
+		query.RecursionDesired = false
+		if _, err := p.exchange(ctx, addr, &query, nil); err != nil {
+			errs = append(errs, fmt.Errorf("server %v is unreachable: %w", addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateAddr checks the syntax of a server address.
+func validateAddr(addr string) error {
+	switch {
+	case isHTTPSAddr(addr):
+		u, err := url.Parse(addr)
+		if err != nil {
+			return fmt.Errorf("invalid DNS-over-HTTPS URL %q: %w", addr, err)
+		} else if u.Host == "" {
+			return fmt.Errorf("invalid DNS-over-HTTPS URL %q: missing host", addr)
+		}
+		return nil
+	case isStampAddr(addr):
+		_, err := parseStamp(addr)
+		return err
+	case isUnixAddr(addr):
+		if strings.TrimPrefix(addr, "unix:") == "" {
+			return fmt.Errorf("invalid Unix socket address %q: missing path", addr)
+		}
+		return nil
+	}
+
+	hostport := trimTransport(addr)
+	if scheme, _, ok := strings.Cut(hostport, "://"); ok {
+		return fmt.Errorf("invalid server address %q: unsupported transport %q", addr, scheme)
+	}
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return fmt.Errorf("invalid server address %q: %w", addr, err)
+	}
+	if host == "" {
+		return fmt.Errorf("invalid server address %q: missing host", addr)
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return fmt.Errorf("invalid server address %q: invalid port %q", addr, port)
+	}
+	return nil
+}
+
+func isIPAddr(s string) bool {
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+// validateKeys checks that the keys used to sign messages can be loaded.
+func (p *Provider) validateKeys(ctx context.Context) []error {
+	var errs []error
+	if p.SIG0KeyFile != "" {
+		if _, err := p.sig0Key(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if p.GSSTSIG {
+		if _, err := p.kerberosClient(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	configs := make(map[string]*TSIGKey, len(p.ZoneKeys)+1)
+	if p.TSIGKeyName != "" || p.TSIGSecret != "" || p.TSIGSecretFile != "" || p.TSIGSecretEnv != "" {
+		configs["TSIG key"] = p.defaultTSIGKeyConfig()
+	}
+	for zone, config := range p.ZoneKeys {
+		configs[fmt.Sprintf("TSIG key for zone %v", zone)] = &config
+	}
+	for zone, config := range p.Zones {
+		if config.Key != nil {
+			configs[fmt.Sprintf("TSIG key for zone %v", zone)] = config.Key
+		}
+	}
+	for name, config := range p.Views {
+		if config.Key != nil {
+			configs[fmt.Sprintf("TSIG key of view %v", name)] = config.Key
+		}
+	}
+	for i, config := range p.FallbackTSIGKeys {
+		configs[fmt.Sprintf("fallback TSIG key #%d", i+1)] = &config
+	}
+	for desc, config := range configs {
+		if config.Name == "" {
+			errs = append(errs, fmt.Errorf("%v: missing name", desc))
+		} else if _, err := p.loadTSIGKey(ctx, config); err != nil {
+			errs = append(errs, fmt.Errorf("%v %v: %w", desc, config.Name, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,47 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// ErrNotServed is returned when VerifyWrites is set and the server doesn't
+// serve records it accepted in an update.
+var ErrNotServed = errors.New("updated records not served")
+
+// verifyServed queries the RRsets of the records, and checks that they
+// contain all of them.
+func (p *Provider) verifyServed(ctx context.Context, rrs []dns.RR) error {
+	var (
+		keys   []rrsetKey
+		groups = make(map[rrsetKey][]dns.RR)
+	)
+	for _, rr := range rrs {
+		key := rrsetKeyOf(rr)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], rr)
+	}
+
+	for _, key := range keys {
+		served, err := p.lookupRRset(ctx, key.name, key.rtype)
+		if err != nil && !errors.Is(err, ErrNXDomain) {
+			return fmt.Errorf("failed to verify update: %w", err)
+		}
+
+		// TTLs are ignored, as servers may cap them
+		for _, rr := range groups[key] {
+			if !slices.ContainsFunc(served, func(s dns.RR) bool {
+				return dns.IsDuplicate(s, rr)
+			}) {
+				return fmt.Errorf("%w: %v", ErrNotServed, rr)
+			}
+		}
+	}
+	return nil
+}
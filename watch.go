@@ -0,0 +1,204 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// ZoneChange reports a change of a zone, as announced by a NOTIFY message.
+type ZoneChange struct {
+	// Name of the zone that changed.
+	Zone string
+
+	// SOA serial announced in the NOTIFY message, or zero if none was
+	// included.
+	Serial uint32
+
+	// Records of the zone after the change, only set if WatchRecords is
+	// enabled.
+	Records []libdns.Record
+
+	// Error that occurred while fetching the records of the zone.
+	Err error
+}
+
+// notifyListener receives the NOTIFY messages for all the watched zones.
+type notifyListener struct {
+	servers  []*dns.Server
+	watchers map[string][]*watcher
+}
+
+// watcher is registered by each Watch call.
+type watcher struct {
+	// Serial of the last NOTIFY message that wasn't handled yet
+	pending chan uint32
+}
+
+// Watch listens for NOTIFY messages sent by the primary server on NotifyAddr,
+// and reports changes of the zone on the returned channel until the context
+// is cancelled. NOTIFY messages are not authenticated, so they are only
+// treated as a hint that the zone may have changed.
+//
+// Notifications received while the previous change is being handled are
+// coalesced.
+func (p *Provider) Watch(ctx context.Context, zone string) (<-chan ZoneChange, error) {
+	zone, err := p.resolveZone(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{pending: make(chan uint32, 1)}
+	if err := p.addWatcher(zone, w); err != nil {
+		return nil, err
+	}
+
+	changes := make(chan ZoneChange)
+	go func() {
+		defer close(changes)
+		defer p.removeWatcher(zone, w)
+
+		for {
+			var serial uint32
+			select {
+			case <-ctx.Done():
+				return
+			case serial = <-w.pending:
+			}
+
+			change := ZoneChange{Zone: zone, Serial: serial}
+			if p.WatchRecords {
+				change.Records, change.Err = p.GetRecords(ctx, zone)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case changes <- change:
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// addWatcher registers a watcher for a zone, starting to listen for NOTIFY
+// messages if needed.
+func (p *Provider) addWatcher(zone string, w *watcher) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.notify == nil {
+		if p.NotifyAddr == "" {
+			return errors.New("no NOTIFY listen address configured")
+		}
+
+		servers, err := p.listenNotify()
+		if err != nil {
+			return err
+		}
+		p.notify = &notifyListener{
+			servers:  servers,
+			watchers: make(map[string][]*watcher),
+		}
+	}
+
+	zone = dns.CanonicalName(zone)
+	p.notify.watchers[zone] = append(p.notify.watchers[zone], w)
+	return nil
+}
+
+// removeWatcher unregisters a watcher, and stops listening for NOTIFY
+// messages once no zone is watched anymore.
+func (p *Provider) removeWatcher(zone string, w *watcher) {
+	p.mu.Lock()
+	zone = dns.CanonicalName(zone)
+	watchers := slices.DeleteFunc(p.notify.watchers[zone], func(other *watcher) bool {
+		return other == w
+	})
+	if len(watchers) > 0 {
+		p.notify.watchers[zone] = watchers
+	} else {
+		delete(p.notify.watchers, zone)
+	}
+
+	var servers []*dns.Server
+	if len(p.notify.watchers) == 0 {
+		servers = p.notify.servers
+		p.notify = nil
+	}
+	p.mu.Unlock()
+
+	// Pending NOTIFY messages are handled during shutdown, so the lock must
+	// be released
+	for _, server := range servers {
+		server.Shutdown()
+	}
+}
+
+// listenNotify starts servers receiving NOTIFY messages over UDP and TCP.
+func (p *Provider) listenNotify() ([]*dns.Server, error) {
+	handler := dns.HandlerFunc(p.handleNotify)
+
+	packetConn, err := net.ListenPacket("udp", p.NotifyAddr)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	if err != nil {
+		packetConn.Close()
+		return nil, err
+	}
+
+	servers := []*dns.Server{
+		{PacketConn: packetConn, Handler: handler},
+		{Listener: listener, Handler: handler},
+	}
+	for _, server := range servers {
+		// Wait for the server to start, otherwise it can't be shut down
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+		go server.ActivateAndServe()
+		<-started
+	}
+	return servers, nil
+}
+
+// handleNotify acknowledges a NOTIFY message, and wakes up the watchers of
+// the zone.
+func (p *Provider) handleNotify(rw dns.ResponseWriter, msg *dns.Msg) {
+	var reply dns.Msg
+	if msg.Opcode != dns.OpcodeNotify || len(msg.Question) != 1 || msg.Question[0].Qtype != dns.TypeSOA {
+		reply.SetRcode(msg, dns.RcodeRefused)
+		rw.WriteMsg(&reply)
+		return
+	}
+
+	var serial uint32
+	for _, rr := range msg.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			serial = soa.Serial
+		}
+	}
+
+	zone := dns.CanonicalName(msg.Question[0].Name)
+	p.mu.Lock()
+	if p.notify != nil {
+		for _, w := range p.notify.watchers[zone] {
+			// Replace the pending notification, if any
+			select {
+			case <-w.pending:
+			default:
+			}
+			w.pending <- serial
+		}
+	}
+	p.mu.Unlock()
+
+	reply.SetReply(msg)
+	reply.Authoritative = true
+	rw.WriteMsg(&reply)
+}
@@ -0,0 +1,126 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// FindZone returns the zone enclosing a name, such as the FQDN of a record,
+// by walking up its labels with SOA queries until a zone apex or a zone cut
+// is found. This way, callers don't need to know where zones are delegated:
+// the zone of "www.sub.example.org." may be "sub.example.org." or
+// "example.org.".
+func (p *Provider) FindZone(ctx context.Context, name string) (zone string, err error) {
+	ctx, span := p.startSpan(ctx, "FindZone", name)
+	defer func() { endSpan(span, err) }()
+
+	name, err = toASCII(dns.Fqdn(name))
+	if err != nil {
+		return "", err
+	}
+	return p.findZone(ctx, name, "")
+}
+
+// findZone walks up the labels of a name to find its zone. The walk stops at
+// the top zone, if set, which is then returned.
+func (p *Provider) findZone(ctx context.Context, name, top string) (string, error) {
+	for n, off := name, 0; ; {
+		if top != "" && dns.CanonicalName(n) == dns.CanonicalName(top) {
+			return top, nil
+		}
+		zone, err := p.zoneApex(ctx, n)
+		if zone != "" || err != nil {
+			return zone, err
+		}
+
+		var end bool
+		off, end = dns.NextLabel(name, off)
+		if end {
+			return "", fmt.Errorf("no zone found for %v", name)
+		}
+		n = name[off:]
+	}
+}
+
+// zoneApex queries the SOA record of a name, and returns the apex of its
+// zone if the reply shows it: the name itself if it has a SOA record, the
+// owner of the SOA record returned with a negative answer, or the owner of
+// the NS records of a referral. An empty zone means the walk must go on.
+func (p *Provider) zoneApex(ctx context.Context, name string) (string, error) {
+	var query dns.Msg
+	query.SetQuestion(name, dns.TypeSOA)
+	query.RecursionDesired = false
+
+	reply, err := p.roundTrip(ctx, &query)
+	switch {
+	case errors.Is(err, ErrNXDomain) || isNotAuthoritative(err):
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+
+	if _, err := replySerial(name, reply); err == nil {
+		return name, nil
+	}
+	for _, rr := range reply.Ns {
+		owner := rr.Header().Name
+		if !dns.IsSubDomain(owner, name) {
+			continue
+		}
+		switch rr.(type) {
+		case *dns.SOA:
+			if reply.Authoritative {
+				return owner, nil
+			}
+		case *dns.NS:
+			if !reply.Authoritative {
+				return owner, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// splitZones splits an update message into one message per zone, when some
+// of its records are below a zone cut, as detected by findZone.
+func (p *Provider) splitZones(ctx context.Context, query *dns.Msg) ([]*dns.Msg, error) {
+	top := query.Question[0].Name
+
+	var (
+		zones  []string
+		groups = make(map[string][]dns.RR)
+		known  = make(map[string]string)
+	)
+	for _, rr := range query.Ns {
+		name := dns.CanonicalName(rr.Header().Name)
+		zone, ok := known[name]
+		if !ok {
+			var err error
+			zone, err = p.findZone(ctx, name, top)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find zone of %v: %w", name, err)
+			}
+			known[name] = zone
+		}
+
+		if _, ok := groups[zone]; !ok {
+			zones = append(zones, zone)
+		}
+		groups[zone] = append(groups[zone], rr)
+	}
+	if len(zones) <= 1 && (len(zones) == 0 || zones[0] == top) {
+		return []*dns.Msg{query}, nil
+	}
+
+	msgs := make([]*dns.Msg, len(zones))
+	for i, zone := range zones {
+		msg := query.Copy()
+		msg.Question[0].Name = zone
+		msg.Ns = groups[zone]
+		msgs[i] = msg
+	}
+	return msgs, nil
+}
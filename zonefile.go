@@ -0,0 +1,119 @@
+package dnsupdate
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// ImportZoneFile adds the records of a zone file in the RFC 1035 master file
+// format to the zone, which is also the default origin of the file. The SOA
+// record is skipped, since it is managed by the server. It returns the
+// records that were added.
+func (p *Provider) ImportZoneFile(ctx context.Context, zone string, r io.Reader) ([]libdns.Record, error) {
+	zone, err := p.resolveZone(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var rrs []dns.RR
+	parser := dns.NewZoneParser(r, dns.Fqdn(zone), "")
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			continue
+		}
+		if !dns.IsSubDomain(zone, rr.Header().Name) {
+			return nil, fmt.Errorf("record %v is outside of zone %v", rr.Header().Name, zone)
+		}
+		rrs = append(rrs, rr)
+	}
+	if err := parser.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var query dns.Msg
+	query.SetUpdate(zone)
+	query.Insert(rrs)
+	if err := ignoreQueued(p.update(ctx, &query)); err != nil {
+		return nil, err
+	}
+
+	return unmarshalSentRecords(zone, rrs), nil
+}
+
+// ExportZoneFile writes all the records of the zone, transferred from the
+// server, in the RFC 1035 master file format.
+func (p *Provider) ExportZoneFile(ctx context.Context, zone string, w io.Writer) error {
+	zone, err := p.resolveZone(zone)
+	if err != nil {
+		return err
+	}
+
+	rrs, err := p.transferZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %v\n", dns.Fqdn(zone))
+	for _, rr := range rrs {
+		fmt.Fprintln(bw, rr)
+	}
+	return bw.Flush()
+}
+
+// zoneFile returns the path of the zone file configured for a zone, if any.
+func (p *Provider) zoneFile(zone string) string {
+	zone = dns.CanonicalName(zone)
+	for name, path := range p.ZoneFiles {
+		if dns.CanonicalName(name) == zone {
+			return path
+		}
+	}
+	return ""
+}
+
+// readZoneFile reads the records of a zone from a master zone file, like a
+// zone transfer: the SOA record comes first.
+func readZoneFile(name, zone string) ([]dns.RR, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		soa dns.RR
+		rrs []dns.RR
+	)
+	parser := dns.NewZoneParser(f, dns.Fqdn(zone), name)
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		hdr := rr.Header()
+		if !dns.IsSubDomain(zone, hdr.Name) {
+			return nil, fmt.Errorf("record %v in zone file %v is outside of zone %v", hdr.Name, name, zone)
+		}
+		if hdr.Rrtype == dns.TypeSOA && dns.CanonicalName(hdr.Name) == dns.CanonicalName(zone) {
+			soa = rr
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+	if err := parser.Err(); err != nil {
+		return nil, err
+	}
+	if soa == nil {
+		return nil, fmt.Errorf("no SOA record found in zone file %v", name)
+	}
+	return append([]dns.RR{soa}, rrs...), nil
+}
@@ -0,0 +1,90 @@
+package dnsupdate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// ZoneConfig overrides the configuration of a provider for a zone and its
+// subdomains, see Provider.Zones.
+type ZoneConfig struct {
+	// Server addresses used for the zone instead of Provider.Addr and
+	// Provider.Addrs, with the same syntax, so the transport is selected by
+	// their prefix.
+	Addr  string   `json:"addr,omitempty"`
+	Addrs []string `json:"addrs,omitempty"`
+
+	// TSIG key used for the zone instead of the provider key.
+	Key *TSIGKey `json:"key,omitempty"`
+}
+
+// zoneConfig returns the configuration of the closest zone enclosing a
+// name in Zones, or nil if there is none.
+func (p *Provider) zoneConfig(zone string) *ZoneConfig {
+	zone = dns.CanonicalName(zone)
+	var (
+		config *ZoneConfig
+		best   string
+	)
+	for name, c := range p.Zones {
+		name = dns.CanonicalName(name)
+		if dns.IsSubDomain(name, zone) && (config == nil || len(name) > len(best)) {
+			config, best = &c, name
+		}
+	}
+	return config
+}
+
+// zoneServers returns the list of DNS server addresses for a zone, in order
+// of preference.
+func (p *Provider) zoneServers(zone string) []string {
+	if addrs := p.zoneConfig(zone).servers(); len(addrs) > 0 {
+		return addrs
+	}
+	return p.servers()
+}
+
+// servers returns the server addresses of a zone or view configuration, in
+// order of preference.
+func (c *ZoneConfig) servers() []string {
+	if c == nil {
+		return nil
+	}
+	var addrs []string
+	if c.Addr != "" {
+		addrs = append(addrs, normalizeServerAddr(c.Addr))
+	}
+	for _, addr := range c.Addrs {
+		addrs = append(addrs, normalizeServerAddr(addr))
+	}
+	return addrs
+}
+
+// viewConfig returns the configuration of the view selected with WithView,
+// or nil if there is none.
+func (p *Provider) viewConfig(ctx context.Context) (*ZoneConfig, error) {
+	name := callOptionsFrom(ctx).view
+	if name == "" {
+		return nil, nil
+	}
+	config, ok := p.Views[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown view %q", name)
+	}
+	return &config, nil
+}
+
+// keyOverride returns the TSIG key set with WithKey, or else the key of the
+// view selected with WithView, or nil if there is none.
+func (p *Provider) keyOverride(ctx context.Context) (*TSIGKey, error) {
+	if key := callOptionsFrom(ctx).key; key != nil {
+		return key, nil
+	}
+	view, err := p.viewConfig(ctx)
+	if view == nil || err != nil {
+		return nil, err
+	}
+	return view.Key, nil
+}